@@ -24,7 +24,7 @@ SCRIPT_DIR=$(cd "$(dirname "$0")" && pwd)
 PROJECT_ROOT=$(dirname "$SCRIPT_DIR")
 
 # The Go file containing the version string, now using an absolute path.
-VERSION_FILE="$PROJECT_ROOT/main.go"
+VERSION_FILE="$PROJECT_ROOT/updater/updater.go"
 
 # --- Mode Selection ---
 
@@ -0,0 +1,16 @@
+package updater
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// accessTime returns the last access time recorded in info, or its modification
+// time when the platform information is unavailable
+func accessTime(info fs.FileInfo) time.Time {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(stat.Atim.Unix())
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !windows
+
+package updater
+
+import (
+	"io/fs"
+	"time"
+)
+
+// accessTime returns the modification time of info: the layout of the access
+// time in the platform information differs between the remaining systems
+func accessTime(info fs.FileInfo) time.Time {
+	return info.ModTime()
+}
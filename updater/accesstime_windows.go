@@ -0,0 +1,16 @@
+package updater
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// accessTime returns the last access time recorded in info, or its modification
+// time when the platform information is unavailable
+func accessTime(info fs.FileInfo) time.Time {
+	if data, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+		return time.Unix(0, data.LastAccessTime.Nanoseconds())
+	}
+	return info.ModTime()
+}
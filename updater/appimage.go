@@ -0,0 +1,25 @@
+package updater
+
+import (
+	"io/fs"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// appImageExt is the extension of AppImages, the self-contained single-file
+// format many Linux applications are distributed in
+const appImageExt = ".AppImage"
+
+// isAppImage reports whether path, described by info, is an executable AppImage.
+// The extension is matched ignoring case, since some projects publish ".appimage".
+func isAppImage(path string, info fs.FileInfo) bool {
+	return runtime.GOOS == "linux" && !info.IsDir() && isExecutable(info) &&
+		strings.EqualFold(filepath.Ext(path), appImageExt)
+}
+
+// isFileType reports whether applications of appType are a single file, which
+// is replaced with a rename instead of a directory update
+func isFileType(appType ApplicationType) bool {
+	return appType == SingleFile || appType == LinuxAppImage
+}
@@ -0,0 +1,286 @@
+package updater
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// verifiedArchive is the release archive whose SHA256 matched --checksum before it
+// was extracted. The checksum then describes the archive, not an executable in it.
+var verifiedArchive string
+
+// isArchivePath reports whether path names a release archive the updater can
+// extract: .zip, .tar.gz or .tgz
+func isArchivePath(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasSuffix(lower, ".zip") || strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz")
+}
+
+// extractArchiveToTemp extracts archivePath into a new temporary directory, under
+// --tmp-dir when given, and returns it. The archive's top level becomes the new
+// application directory. The caller removes the directory once the update no
+// longer needs it.
+func extractArchiveToTemp(archivePath string) (string, error) {
+	extractDir, err := os.MkdirTemp(tempDir, "atom-updater-extract-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create extraction directory: %v", err)
+	}
+
+	if strings.HasSuffix(strings.ToLower(archivePath), ".zip") {
+		err = extractZip(archivePath, extractDir)
+	} else {
+		err = extractTarGz(archivePath, extractDir)
+	}
+	if err != nil {
+		removeExtractedArchive(extractDir)
+		return "", fmt.Errorf("failed to extract %s: %w", archivePath, err)
+	}
+	return extractDir, nil
+}
+
+// removeExtractedArchive removes a directory extractArchiveToTemp created. The
+// directories in it keep the archive's modes, so read-only ones are made
+// writable first for their contents to be removed.
+func removeExtractedArchive(dir string) error {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			if info, err := d.Info(); err == nil && info.Mode().Perm()&0700 != 0700 {
+				os.Chmod(path, info.Mode().Perm()|0700)
+			}
+		}
+		return nil
+	})
+	return os.RemoveAll(dir)
+}
+
+// archiveEntryPath returns where the archive entry name is extracted under destDir,
+// refusing absolute names, names that climb out of it ("Zip Slip") and names that
+// lead through a symlink extracted earlier. The last check is what stops a chain
+// of links such as a -> . and b -> a/.. from reaching outside destDir.
+func archiveEntryPath(destDir, name string) (string, error) {
+	name = filepath.FromSlash(name)
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("archive entry %q has an absolute path", name)
+	}
+	target := filepath.Join(destDir, name)
+	if !isPathWithin(target, destDir) {
+		return "", fmt.Errorf("archive entry %q points outside the extraction directory", name)
+	}
+
+	relPath, err := filepath.Rel(destDir, target)
+	if err != nil {
+		return "", err
+	}
+	parent := destDir
+	components := strings.Split(relPath, string(filepath.Separator))
+	for _, component := range components[:len(components)-1] {
+		parent = filepath.Join(parent, component)
+		info, err := os.Lstat(parent)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return "", fmt.Errorf("archive entry %q leads through the symlink %s", name, parent)
+		}
+	}
+	return target, nil
+}
+
+// checkArchiveLink refuses a symlink entry at target that is absolute or climbs
+// with "..": a release has no need for either, and a link that may leave destDir
+// would let later entries be written through it
+func checkArchiveLink(destDir, target, linkName string) error {
+	if filepath.IsAbs(linkName) || filepath.VolumeName(linkName) != "" || strings.HasPrefix(linkName, "/") {
+		return fmt.Errorf("archive symlink %s -> %s has an absolute target", target, linkName)
+	}
+	for _, component := range strings.Split(filepath.ToSlash(linkName), "/") {
+		if component == ".." {
+			return fmt.Errorf("archive symlink %s -> %s climbs out of its directory", target, linkName)
+		}
+	}
+	if !isPathWithin(filepath.Join(filepath.Dir(target), linkName), destDir) {
+		return fmt.Errorf("archive symlink %s -> %s points outside the extraction directory", target, linkName)
+	}
+	return nil
+}
+
+// writeArchiveFile creates target with the contents of r and the given mode
+// and modification time
+func writeArchiveFile(target string, r io.Reader, mode fs.FileMode, modTime time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	// A symlink extracted earlier must not redirect the write
+	if info, err := os.Lstat(target); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		return fmt.Errorf("%s is already a symlink", target)
+	}
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	// Set the mode explicitly, the umask would otherwise strip bits from it
+	if err := os.Chmod(target, mode.Perm()); err != nil {
+		return err
+	}
+	if !modTime.IsZero() {
+		os.Chtimes(target, modTime, modTime)
+	}
+	return nil
+}
+
+// archiveDir is a directory entry of an archive. Its mode and time are applied
+// once everything has been extracted, so that a read-only directory does not
+// keep its own contents out and adding them does not change its time.
+type archiveDir struct {
+	path    string
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// applyArchiveDirs gives the extracted directories the permission bits and
+// modification times of their archive entries, deepest first
+func applyArchiveDirs(dirs []archiveDir) error {
+	sort.SliceStable(dirs, func(i, j int) bool {
+		return strings.Count(dirs[i].path, string(filepath.Separator)) > strings.Count(dirs[j].path, string(filepath.Separator))
+	})
+	for _, dir := range dirs {
+		if err := os.Chmod(dir.path, dir.mode.Perm()); err != nil {
+			return err
+		}
+		if !dir.modTime.IsZero() {
+			os.Chtimes(dir.path, dir.modTime, dir.modTime)
+		}
+	}
+	return nil
+}
+
+// extractZip extracts the zip archive at archivePath into destDir
+func extractZip(archivePath, destDir string) error {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	var dirs []archiveDir
+	for _, entry := range reader.File {
+		target, err := archiveEntryPath(destDir, entry.Name)
+		if err != nil {
+			return err
+		}
+		mode := entry.Mode()
+
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			dirs = append(dirs, archiveDir{target, mode, entry.Modified})
+		case mode&fs.ModeSymlink != 0:
+			rc, err := entry.Open()
+			if err != nil {
+				return err
+			}
+			linkName, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+			if err := extractSymlink(destDir, target, string(linkName)); err != nil {
+				return err
+			}
+		default:
+			rc, err := entry.Open()
+			if err != nil {
+				return err
+			}
+			err = writeArchiveFile(target, rc, mode, entry.Modified)
+			rc.Close()
+			if err != nil {
+				return fmt.Errorf("failed to extract %s: %v", entry.Name, err)
+			}
+		}
+	}
+	return applyArchiveDirs(dirs)
+}
+
+// extractTarGz extracts the gzip-compressed tar archive at archivePath into destDir
+func extractTarGz(archivePath, destDir string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	reader := tar.NewReader(gz)
+	var dirs []archiveDir
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return applyArchiveDirs(dirs)
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := archiveEntryPath(destDir, header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			dirs = append(dirs, archiveDir{target, header.FileInfo().Mode(), header.ModTime})
+		case tar.TypeSymlink:
+			if err := extractSymlink(destDir, target, header.Linkname); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeArchiveFile(target, reader, header.FileInfo().Mode(), header.ModTime); err != nil {
+				return fmt.Errorf("failed to extract %s: %v", header.Name, err)
+			}
+		default:
+			// Hard links, devices and the like have no place in a release
+			debugf("Skipping archive entry %s of type %c", header.Name, header.Typeflag)
+		}
+	}
+}
+
+// extractSymlink creates the symlink entry target -> linkName
+func extractSymlink(destDir, target, linkName string) error {
+	if err := checkArchiveLink(destDir, target, linkName); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.Symlink(linkName, target)
+}
@@ -0,0 +1,125 @@
+package updater
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// archiveEntry is one entry of a test tarball: a file with content, or a
+// symlink when link is set
+type archiveEntry struct {
+	name    string
+	link    string
+	content string
+}
+
+// writeTestTarGz writes entries to a .tar.gz at path, in order
+func writeTestTarGz(t *testing.T, path string, entries []archiveEntry) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(entry.content))}
+		if entry.link != "" {
+			header = &tar.Header{Name: entry.name, Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: entry.link}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if entry.link == "" {
+			if _, err := tw.Write([]byte(entry.content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractTarGzRefusesEscapes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks needs privileges on Windows")
+	}
+	tests := []struct {
+		name    string
+		entries []archiveEntry
+	}{
+		{"symlink chain", []archiveEntry{
+			{name: "a", link: "."},
+			{name: "b", link: "a/.."},
+			{name: "b/pwned.txt", content: "pwned"},
+		}},
+		{"write through a symlinked directory", []archiveEntry{
+			{name: "a", link: "."},
+			{name: "a/pwned.txt", content: "pwned"},
+		}},
+		{"absolute symlink", []archiveEntry{
+			{name: "a", link: "/tmp"},
+			{name: "a/pwned.txt", content: "pwned"},
+		}},
+		{"overwrite through a file symlink", []archiveEntry{
+			{name: "pwned.txt", link: "self.txt"},
+			{name: "pwned.txt", content: "pwned"},
+		}},
+		{"climbing name", []archiveEntry{
+			{name: "../pwned.txt", content: "pwned"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			archivePath := filepath.Join(root, "release.tar.gz")
+			writeTestTarGz(t, archivePath, tt.entries)
+			destDir := filepath.Join(root, "dest")
+			if err := os.Mkdir(destDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := extractTarGz(archivePath, destDir); err == nil {
+				t.Error("extractTarGz succeeded, want it to refuse the archive")
+			}
+			for _, dir := range []string{root, "/tmp"} {
+				if _, err := os.Lstat(filepath.Join(dir, "pwned.txt")); err == nil {
+					os.Remove(filepath.Join(dir, "pwned.txt"))
+					t.Errorf("pwned.txt was written to %s, outside the extraction directory", dir)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractTarGzKeepsInternalSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks needs privileges on Windows")
+	}
+	root := t.TempDir()
+	archivePath := filepath.Join(root, "release.tar.gz")
+	writeTestTarGz(t, archivePath, []archiveEntry{
+		{name: "lib/libapp.so.1", content: "library"},
+		{name: "lib/libapp.so", link: "libapp.so.1"},
+	})
+	destDir := filepath.Join(root, "dest")
+	if err := os.Mkdir(destDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := extractTarGz(archivePath, destDir); err != nil {
+		t.Fatalf("extractTarGz: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(destDir, "lib", "libapp.so")); err != nil || string(data) != "library" {
+		t.Errorf("lib/libapp.so = %q, %v; want the library through the symlink", data, err)
+	}
+}
@@ -0,0 +1,222 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultMaxBackups is how many kept backups survive pruning unless --max-backups says otherwise
+const defaultMaxBackups = 3
+
+// backupMetadata is written beside a kept backup as <backup>.json, recording
+// what the update replaced and with what for later audits
+type backupMetadata struct {
+	AppPath        string    `json:"app_path"`
+	OldVersion     string    `json:"old_version,omitempty"`
+	NewVersion     string    `json:"new_version,omitempty"`
+	ReplacedAt     time.Time `json:"replaced_at"`
+	UpdaterVersion string    `json:"updater_version"`
+	NewTreeSHA256  string    `json:"new_tree_sha256,omitempty"`
+}
+
+// backupMetadataPath returns where the metadata of the kept backup at keptPath is written
+func backupMetadataPath(keptPath string) string {
+	return filepath.Clean(keptPath) + ".json"
+}
+
+// writeBackupMetadata records the update that replaced the version kept at keptPath
+func writeBackupMetadata(keptPath, currentPath string) error {
+	meta := backupMetadata{
+		AppPath:        currentPath,
+		OldVersion:     readAppVersion(keptPath),
+		NewVersion:     readAppVersion(currentPath),
+		ReplacedAt:     time.Now().UTC(),
+		UpdaterVersion: Version,
+	}
+	sum, err := treeSHA256(currentPath)
+	if err != nil {
+		warnf("Failed to hash %s for the backup metadata: %v", currentPath, err)
+	}
+	meta.NewTreeSHA256 = sum
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(backupMetadataPath(keptPath), data)
+}
+
+// logBackupMetadata logs what the metadata beside backupDir says about it, if there is any
+func logBackupMetadata(backupDir, currentPath string) {
+	data, err := os.ReadFile(backupMetadataPath(backupDir))
+	if os.IsNotExist(err) {
+		infof("No metadata recorded for %s", backupDir)
+		return
+	}
+	var meta backupMetadata
+	if err == nil {
+		err = json.Unmarshal(data, &meta)
+	}
+	if err != nil {
+		warnf("Failed to read backup metadata: %v", err)
+		return
+	}
+
+	infof("Backup of %s, replaced %s by atom-updater %s", meta.AppPath, meta.ReplacedAt.Local().Format(time.RFC3339), meta.UpdaterVersion)
+	infof("  Version: %s (replaced by %s)", valueOrUnknown(meta.OldVersion), valueOrUnknown(meta.NewVersion))
+	if meta.NewTreeSHA256 != "" {
+		infof("  Replacing tree SHA256: %s", meta.NewTreeSHA256)
+	}
+	if meta.AppPath != currentPath {
+		warnf("The backup was taken of %s, not %s", meta.AppPath, currentPath)
+	}
+}
+
+// valueOrUnknown returns value, or "unknown" when it is empty
+func valueOrUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
+
+// keptBackupPrefix returns the name prefix of backups kept for currentPath. They
+// live beside it, or in --backup-dir, as .<name>.atom-backup-<timestamp>.
+func keptBackupPrefix(currentPath string) string {
+	return "." + filepath.Base(filepath.Clean(currentPath)) + ".atom-backup-"
+}
+
+// keptBackupDir returns the directory --keep-backup keeps backups in: --backup-dir,
+// so a full copy is not put back on the volume it keeps backups off, else the
+// parent of current_dir
+func keptBackupDir(config *UpdateConfig) string {
+	if config.BackupDir != "" {
+		return config.BackupDir
+	}
+	return filepath.Dir(filepath.Clean(config.CurrentPath))
+}
+
+// finalizeBackup keeps or removes the previous version once the update is final
+func finalizeBackup(backup *installBackup, config *UpdateConfig) {
+	if backup == nil {
+		return
+	}
+	if !config.KeepBackup {
+		backup.discard()
+		return
+	}
+	if backup.partial {
+		warnf("Incremental updates only back up the files they overwrite, not keeping the backup")
+		backup.discard()
+		return
+	}
+
+	keptPath := filepath.Join(keptBackupDir(config), keptBackupPrefix(config.CurrentPath)+time.Now().Format("20060102-150405"))
+	if err := renameOrCopy(backup.dir, keptPath); err != nil {
+		warnf("Failed to keep backup at %s: %v", keptPath, err)
+		backup.discard()
+		return
+	}
+	backup.journal.remove()
+	if err := writeBackupMetadata(keptPath, config.CurrentPath); err != nil {
+		warnf("Failed to write backup metadata: %v", err)
+	}
+
+	infof("Previous version kept at %s", keptPath)
+	runSummary.update(func(sum *updateSummary) { sum.BackupPath = keptPath })
+	// The run summary reports the path instead, keeping stdout a single JSON object
+	if !config.JSONSummary && !config.Silent {
+		fmt.Println(keptPath)
+	}
+
+	maxBackups := config.MaxBackups
+	if maxBackups <= 0 {
+		maxBackups = defaultMaxBackups
+	}
+	if err := pruneKeptBackups(keptBackupDir(config), config.CurrentPath, maxBackups); err != nil {
+		warnf("Failed to prune old backups: %v", err)
+	}
+}
+
+// pruneKeptBackups removes the oldest backups of currentPath kept in parent beyond the newest max
+func pruneKeptBackups(parent, currentPath string, max int) error {
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		return err
+	}
+
+	prefix := keptBackupPrefix(currentPath)
+	var kept []string
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), prefix) {
+			kept = append(kept, entry.Name())
+		}
+	}
+	if len(kept) <= max {
+		return nil
+	}
+
+	// Timestamps sort lexically, oldest first
+	sort.Strings(kept)
+	for _, name := range kept[:len(kept)-max] {
+		infof("Pruning old backup %s", name)
+		if err := os.RemoveAll(filepath.Join(parent, name)); err != nil {
+			return err
+		}
+		os.Remove(backupMetadataPath(filepath.Join(parent, name)))
+	}
+	return nil
+}
+
+// runRollback implements `--rollback <backup-dir> <current-dir>`: it puts a kept
+// backup back in place with the same backup-and-verify replacement an update uses
+func runRollback(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: %s --rollback <backup_dir> <current_dir>", os.Args[0])
+	}
+
+	backupDir, err := filepath.Abs(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to resolve backup path '%s': %v", args[0], err)
+	}
+	currentPath, err := filepath.Abs(args[1])
+	if err != nil {
+		return fmt.Errorf("failed to resolve current path '%s': %v", args[1], err)
+	}
+
+	// A backup of a single-file install is itself a file
+	var isDir []bool
+	for _, path := range []string{backupDir, currentPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		isDir = append(isDir, info.IsDir())
+	}
+	if isDir[0] != isDir[1] {
+		return fmt.Errorf("%w: %s and %s must both be directories or both be files", ErrIncompatibleTypes, backupDir, currentPath)
+	}
+
+	infof("Rolling back %s to %s", currentPath, backupDir)
+	logBackupMetadata(backupDir, currentPath)
+	config := &UpdateConfig{CurrentPath: currentPath, NewPath: backupDir, AllowSingleFile: !isDir[0], NoLaunch: true}
+	backup, err := atomicReplace(context.Background(), currentPath, backupDir, config)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRollbackFailed, err)
+	}
+	backup.discard()
+
+	// The kept backup is the installed version now
+	if err := os.RemoveAll(backupDir); err != nil {
+		warnf("failed to remove %s: %v", backupDir, err)
+	}
+	os.Remove(backupMetadataPath(backupDir))
+	infof("Rollback completed")
+	return nil
+}
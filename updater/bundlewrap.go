@@ -0,0 +1,72 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// wrapBundleArgs implements --auto-wrap-bundle: a current_dir or new_dir naming a
+// .app bundle is replaced by the directory holding it, and the update is limited
+// to that bundle, so /Applications/MyApp.app can be passed as it is. Without the
+// option, or when neither path is a bundle, config is left unchanged.
+func wrapBundleArgs(config *UpdateConfig) error {
+	if !config.AutoWrapBundle {
+		return nil
+	}
+
+	currentBundle, err := bundleArg(config.CurrentPath, "current")
+	if err != nil {
+		return err
+	}
+	newBundle, err := bundleArg(config.NewPath, "new")
+	if err != nil {
+		return err
+	}
+	if currentBundle == "" && newBundle == "" {
+		return nil
+	}
+	if currentBundle != "" && newBundle != "" && currentBundle != newBundle {
+		return fmt.Errorf("--auto-wrap-bundle needs bundles with the same name, got %s and %s", currentBundle, newBundle)
+	}
+	if config.Harden {
+		return fmt.Errorf("--harden cannot be combined with a wrapped .app bundle")
+	}
+
+	bundle := currentBundle
+	if bundle == "" {
+		bundle = newBundle
+	}
+	if currentBundle != "" {
+		config.CurrentPath = filepath.Dir(filepath.Clean(config.CurrentPath))
+	}
+	if newBundle != "" {
+		config.NewPath = filepath.Dir(filepath.Clean(config.NewPath))
+	}
+	wrappedBundle = bundle
+
+	// Launch the bundle that was updated, not whichever comes first in its directory
+	if config.AppName == "" {
+		config.AppName = strings.TrimSuffix(bundle, ".app")
+	}
+
+	infof("Updating only %s: current %s, new %s (--auto-wrap-bundle)", bundle, config.CurrentPath, config.NewPath)
+	return nil
+}
+
+// bundleArg returns the name of the .app bundle path names, or "" when it is not one
+func bundleArg(path, which string) (string, error) {
+	name := filepath.Base(filepath.Clean(path))
+	if !strings.HasSuffix(name, ".app") {
+		return "", nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("%s application %w: %s", which, ErrPathNotFound, path)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s path %s is not a .app bundle directory", which, path)
+	}
+	return name, nil
+}
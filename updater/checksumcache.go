@@ -0,0 +1,121 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// checksumCacheEntry is a file hash remembered by --checksum-cache, valid while
+// the file keeps the size and modification time it had when it was hashed
+type checksumCacheEntry struct {
+	Size   int64  `json:"size"`
+	MTime  int64  `json:"mtime"` // nanoseconds since the Unix epoch
+	SHA256 string `json:"sha256"`
+}
+
+// checksumCache holds the SHA256 hashes of files by absolute path. Files may be
+// hashed from several goroutines, so every access goes through mu.
+type checksumCache struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]checksumCacheEntry
+	hits    int
+	misses  int
+}
+
+// hashCache is the cache loaded from --checksum-cache, or nil when hashes are
+// always computed
+var hashCache *checksumCache
+
+// loadChecksumCache reads the cache at path. A missing file starts an empty
+// cache, and an unreadable one is logged and started over.
+func loadChecksumCache(path string) *checksumCache {
+	cache := &checksumCache{path: path, entries: make(map[string]checksumCacheEntry)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cache
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &cache.entries)
+	}
+	if err != nil {
+		warnf("Ignoring checksum cache %s: %v", path, err)
+		cache.entries = make(map[string]checksumCacheEntry)
+	}
+	return cache
+}
+
+// sha256 returns the hash of path from the cache when its size and modification
+// time are unchanged, and otherwise hashes it and remembers the result
+func (c *checksumCache) sha256(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[absPath]
+	c.mu.Unlock()
+	if ok && entry.Size == info.Size() && entry.MTime == info.ModTime().UnixNano() {
+		c.mu.Lock()
+		c.hits++
+		c.mu.Unlock()
+		return entry.SHA256, nil
+	}
+
+	sum, err := hashFile(absPath)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.entries[absPath] = checksumCacheEntry{Size: info.Size(), MTime: info.ModTime().UnixNano(), SHA256: sum}
+	c.misses++
+	c.mu.Unlock()
+	return sum, nil
+}
+
+// save writes the cache back, dropping the files that no longer exist. The
+// file is replaced with a rename so an interrupted run never leaves half a cache.
+func (c *checksumCache) save() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for path := range c.entries {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			delete(c.entries, path)
+		}
+	}
+	infof("Checksum cache: %d hashes reused, %d computed", c.hits, c.misses)
+
+	data, err := json.Marshal(c.entries)
+	if err == nil {
+		err = writeFileAtomically(c.path, data)
+	}
+	if err != nil {
+		warnf("Failed to save checksum cache %s: %v", c.path, err)
+	}
+}
+
+// writeFileAtomically writes data to a temp file beside path and renames it over path
+func writeFileAtomically(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tempPath := generateTempFilename(path, "tmp")
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to move %s into place: %v", tempPath, err)
+	}
+	return nil
+}
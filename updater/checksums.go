@@ -0,0 +1,163 @@
+package updater
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checksumManifestName is the manifest inside a new version listing expected file hashes
+const checksumManifestName = "checksums.txt"
+
+// loadChecksumManifest reads "<sha256>  <relative-path>" lines (sha256sum format)
+// into a map keyed by slash-separated relative path
+func loadChecksumManifest(manifestPath string) (map[string]string, error) {
+	file, err := os.Open(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checksum manifest: %v", err)
+	}
+	defer file.Close()
+
+	checksums := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 || len(fields[0]) != 64 {
+			return nil, fmt.Errorf("%s:%d: expected '<sha256>  <path>'", manifestPath, lineNumber)
+		}
+
+		// sha256sum marks binary mode with a leading '*'
+		relPath := strings.TrimPrefix(strings.TrimSpace(fields[1]), "*")
+		checksums[filepath.ToSlash(filepath.Clean(relPath))] = strings.ToLower(fields[0])
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read checksum manifest: %v", err)
+	}
+	return checksums, nil
+}
+
+// verifyManifestFiles checks every file listed in root's checksum manifest.
+// It reports false without error when root has no manifest.
+func verifyManifestFiles(root string) (bool, error) {
+	manifestPath := filepath.Join(root, checksumManifestName)
+	if _, err := os.Stat(manifestPath); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	checksums, err := loadChecksumManifest(manifestPath)
+	if err != nil {
+		return true, err
+	}
+
+	for relPath, expected := range checksums {
+		if isPreservedRel(relPath) {
+			continue // The installed copy is the user's, not the one the manifest describes
+		}
+		if isExcludedRel(relPath) {
+			continue // Never installed
+		}
+		if err := verifyChecksum(filepath.Join(root, filepath.FromSlash(relPath)), expected); err != nil {
+			return true, fmt.Errorf("%s: %w", relPath, err)
+		}
+	}
+	return true, nil
+}
+
+// verifyNewVersion checks the new version before anything is replaced: its primary
+// executable against the expected checksum, unless that was the checksum of the
+// archive it came from, and its files against checksums.txt
+func verifyNewVersion(newPath string, config *UpdateConfig) error {
+	verified := verifiedArchive != ""
+
+	if config.Checksum != "" && verifiedArchive == "" {
+		exePath, err := findExecutableInDirectory(newPath, appNameCandidates(config.AppName))
+		if err != nil {
+			return fmt.Errorf("cannot locate the executable to checksum (use %s instead): %w", checksumManifestName, err)
+		}
+		if err := verifyChecksum(exePath, strings.ToLower(config.Checksum)); err != nil {
+			return fmt.Errorf("%s: %w", exePath, err)
+		}
+		verified = true
+	}
+
+	found, err := verifyManifestFiles(newPath)
+	if err != nil {
+		return err
+	}
+	if found {
+		infof("All files listed in %s verified", checksumManifestName)
+		verified = true
+	}
+
+	if !verified {
+		return fmt.Errorf("nothing to verify: pass --checksum or include %s in the new version", checksumManifestName)
+	}
+	return nil
+}
+
+// treeSHA256 returns one hash for the contents of root: the SHA256 of its file
+// listing in sha256sum format ("<sha256>  <relative-path>" lines in path order), with
+// symlinks listed by target. Preserved paths and updater artifacts are left out, as
+// they are not part of the installed version. A file is hashed on its own.
+func treeSHA256(root string) (string, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return fileSHA256(root)
+	}
+
+	listing := sha256.New()
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		if isUpdaterArtifact(d.Name()) || isPreserved(root, path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(listing, "-> %s  %s\n", target, relPath)
+		case d.Type().IsRegular():
+			sum, err := fileSHA256(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(listing, "%s  %s\n", sum, relPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", listing.Sum(nil)), nil
+}
@@ -0,0 +1,112 @@
+package updater
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// artifactPatterns match the names of files and directories the updater creates
+// while working. Anything else is never touched by the clean command.
+var artifactPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^\.backup\.[0-9a-f]{8}$`),       // directory backups
+	regexp.MustCompile(`\.(tmp|new|old)\.[0-9a-f]{8}$`), // single-file, marker and --swap temps
+	regexp.MustCompile(`\.app\.(new|old|current)$`),     // .app bundle swap temps
+	regexp.MustCompile(`\.atom-updater-journal$`),       // update journals
+}
+
+// isUpdaterArtifact reports whether name looks like something the updater left behind
+func isUpdaterArtifact(name string) bool {
+	for _, pattern := range artifactPatterns {
+		if pattern.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// runClean implements `clean <dir> [--dry-run]`
+func runClean(args []string) error {
+	var dir string
+	dryRun := false
+
+	for _, arg := range args {
+		switch {
+		case arg == "--dry-run":
+			dryRun = true
+		case strings.HasPrefix(arg, "--"):
+			return fmt.Errorf("unknown option '%s' for clean", arg)
+		case dir == "":
+			dir = arg
+		default:
+			return fmt.Errorf("clean takes a single directory")
+		}
+	}
+
+	if dir == "" {
+		return fmt.Errorf("usage: %s clean <dir> [--dry-run]", os.Args[0])
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve directory '%s': %v", dir, err)
+	}
+
+	removed, reclaimed, err := cleanArtifacts(absDir, dryRun)
+	if err != nil {
+		return err
+	}
+
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	fmt.Printf("%s %d artifacts, %d bytes\n", verb, removed, reclaimed)
+	return nil
+}
+
+// cleanArtifacts removes updater artifacts under root, printing each one.
+// With dryRun it only reports what would be removed.
+func cleanArtifacts(root string, dryRun bool) (removed int, reclaimed int64, err error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to stat %s: %v", root, err)
+	}
+	if !info.IsDir() {
+		return 0, 0, fmt.Errorf("%s is not a directory", root)
+	}
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root || !isUpdaterArtifact(d.Name()) {
+			return nil
+		}
+
+		size := int64(0)
+		if d.IsDir() {
+			_, size, _ = measureTree(path)
+		} else if info, err := d.Info(); err == nil {
+			size = info.Size()
+		}
+
+		fmt.Printf("%s (%d bytes)\n", path, size)
+		if !dryRun {
+			if err := os.RemoveAll(path); err != nil {
+				return fmt.Errorf("failed to remove %s: %v", path, err)
+			}
+		}
+
+		removed++
+		reclaimed += size
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return removed, reclaimed, err
+}
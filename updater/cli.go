@@ -0,0 +1,629 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Main runs the atom-updater command line with args (os.Args) and exits the
+// process with one of the Exit* codes when the update fails
+func Main(args []string) {
+	// --silent also covers mistakes in the command line, which are reported while parsing it
+	for _, arg := range args[1:] {
+		if arg == "--silent" {
+			log.SetOutput(io.Discard)
+		}
+	}
+
+	// Parse command line arguments
+	config, err := parseArgs(args)
+	if err != nil {
+		exitf(exitCodeOf(err, ExitBadArgs), "%v", err)
+	}
+
+	// Handle special commands
+	if config == nil {
+		return // Version or help was displayed
+	}
+
+	// Setup logging to both console and file
+	logFilePath := setupLogging(config)
+	setLogLevel(config.LogLevel, config.Verbose)
+	setLogFormat(config.LogFormat)
+
+	infof("=== Atom-Updater Started ===")
+	if logFilePath != "" {
+		infof("Log file: %s", logFilePath)
+	}
+
+	// Ctrl-C or a termination request rolls back instead of leaving a half-copied install
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	targets, err := expandTargets(config.CurrentPath, config.NewPath)
+	if err != nil {
+		exitf(ExitBadArgs, "%v", err)
+	}
+	if len(targets) == 1 {
+		config.CurrentPath = targets[0]
+		err = runTarget(ctx, *config)
+	} else {
+		err = runTargets(ctx, config, targets)
+	}
+	if err != nil {
+		exitf(ExitCode(err), "%v", err)
+	}
+}
+
+// printVersion prints the version information
+func printVersion() {
+	// fmt.Printf("atom-updater version %s\n", Version)
+	// fmt.Printf("Built with %s on %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Printf("%s\n", Version)
+}
+
+// setupLogging configures logging to the console and, unless --no-log-file is given,
+// to a log file: --log-file, or atom-updater.log next to the executable. The file is
+// truncated unless --append-log is given. It returns the log file path, or "" when
+// only the console is used. With --silent nothing is logged anywhere.
+func setupLogging(config *UpdateConfig) string {
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	if config.Silent {
+		// The exit code, and --json-summary when asked for, are all the caller gets
+		log.SetOutput(io.Discard)
+		errorConsole = nil
+		return ""
+	}
+	if config.Quiet {
+		// Errors still reach the console; everything else only the log file
+		log.SetOutput(io.Discard)
+		errorConsole = log.New(os.Stderr, "", log.Flags())
+	}
+	if config.NoLogFile {
+		return ""
+	}
+
+	logFilePath := config.LogFile
+	if logFilePath == "" {
+		// Get the directory where the executable is located
+		execPath, err := os.Executable()
+		if err != nil {
+			warnf("Could not get executable path: %v", err)
+			execPath = "atom-updater" // fallback
+		}
+		logFilePath = filepath.Join(filepath.Dir(execPath), "atom-updater.log")
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if !config.AppendLog {
+		// Clear the log file at startup
+		flags |= os.O_TRUNC
+	}
+
+	logFile, err := os.OpenFile(logFilePath, flags, 0666)
+	if err != nil {
+		// Installed apps often live in directories we may not write to
+		warnf("Could not open log file %s: %v", logFilePath, err)
+		infof("Continuing with console-only logging...")
+		return ""
+	}
+
+	// Set up logging to both console and file
+	if config.Quiet {
+		log.SetOutput(logFile)
+	} else {
+		log.SetOutput(io.MultiWriter(os.Stderr, logFile))
+	}
+	return logFilePath
+}
+
+// parseArgs parses command line arguments with support for the new app name parameter
+func parseArgs(args []string) (*UpdateConfig, error) {
+	if len(args) < 2 {
+		showUsage()
+		return nil, nil
+	}
+
+	switch args[1] {
+	case "-v", "--version":
+		printVersion()
+		return nil, nil
+
+	case "-h", "--help":
+		showHelp()
+		return nil, nil
+
+	case "clean":
+		setupLogging(&UpdateConfig{})
+		return nil, withExitCode(ExitUnexpected, runClean(args[2:]))
+
+	case "detect":
+		setupLogging(&UpdateConfig{NoLogFile: true})
+		return nil, withExitCode(ExitUnexpected, runDetect(args[2:]))
+
+	case "list-executables":
+		setupLogging(&UpdateConfig{NoLogFile: true})
+		return nil, withExitCode(ExitUnexpected, runListExecutables(args[2:]))
+
+	case "--recover":
+		setupLogging(&UpdateConfig{})
+		return nil, withExitCode(ExitUnexpected, runRecover(args[2:]))
+
+	case "--rollback":
+		setupLogging(&UpdateConfig{})
+		return nil, withExitCode(ExitUnexpected, runRollback(args[2:]))
+	}
+
+	// Parse update command arguments
+	// Support both old format: <pid> <current_path> <new_path>
+	// And new format: <pid> <current_path> <new_path> --app-name <name>
+	// Options may appear anywhere after the program name
+	config := &UpdateConfig{}
+	var positional []string
+
+	// A config file provides the defaults; everything on the command line overrides it
+	configFile := ""
+	for i := 1; i < len(args); i++ {
+		if args[i] == "--config" {
+			var err error
+			if configFile, err = flagValue(args, &i); err != nil {
+				return nil, err
+			}
+			if configFile != stdinConfigPath {
+				if configFile, err = expandPath(configFile); err != nil {
+					return nil, err
+				}
+			}
+			if err := loadConfigFile(configFile, config); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "--") {
+			positional = append(positional, arg)
+			continue
+		}
+
+		var err error
+		switch arg {
+		case "--config":
+			_, err = flagValue(args, &i) // Already loaded above
+		case "--app-name":
+			config.AppName, err = flagValue(args, &i)
+		case "--timeout":
+			config.Timeout, err = intFlagValue(args, &i)
+		case "--wait-process-name":
+			config.WaitProcessName, err = flagValue(args, &i)
+		case "--no-wait":
+			config.NoWait = true
+		case "--timeout-exit-code":
+			config.TimeoutExitCode, err = intFlagValue(args, &i)
+		case "--timeout-action":
+			config.TimeoutAction, err = flagValue(args, &i)
+		case "--checksum":
+			config.Checksum, err = flagValue(args, &i)
+			config.VerifyChecksum = true
+		case "--verify-after-copy":
+			config.VerifyAfterCopy = true
+		case "--verify-checksum":
+			config.VerifyChecksum = true
+		case "--health-check-url":
+			config.HealthCheckURL, err = flagValue(args, &i)
+		case "--health-check-timeout":
+			config.HealthCheckTimeout, err = intFlagValue(args, &i)
+		case "--launch-verify-seconds":
+			config.LaunchVerifySeconds, err = intFlagValue(args, &i)
+		case "--watchdog-timeout":
+			config.WatchdogTimeout, err = intFlagValue(args, &i)
+		case "--progress-fd":
+			config.ProgressFD, err = intFlagValue(args, &i)
+		case "--progress-file":
+			config.ProgressFile, err = flagValue(args, &i)
+		case "--keep-backup":
+			config.KeepBackup = true
+		case "--max-backups":
+			config.MaxBackups, err = intFlagValue(args, &i)
+		case "--handoff-socket":
+			config.HandoffSocket, err = flagValue(args, &i)
+		case "--handoff-timeout":
+			config.HandoffTimeout, err = intFlagValue(args, &i)
+		case "--verbose":
+			config.Verbose = true
+		case "--make-executable":
+			var pattern string
+			pattern, err = flagValue(args, &i)
+			config.MakeExecutable = append(config.MakeExecutable, pattern)
+		case "--require-path":
+			var relPath string
+			relPath, err = flagValue(args, &i)
+			config.RequirePaths = append(config.RequirePaths, relPath)
+		case "--preserve":
+			var pattern string
+			if pattern, err = flagValue(args, &i); err == nil {
+				if _, matchErr := path.Match(filepath.ToSlash(pattern), ""); matchErr != nil {
+					err = fmt.Errorf("invalid --preserve pattern '%s': %v", pattern, matchErr)
+				}
+			}
+			config.Preserve = append(config.Preserve, pattern)
+		case "--exclude":
+			var pattern string
+			if pattern, err = flagValue(args, &i); err == nil {
+				if _, matchErr := path.Match(filepath.ToSlash(pattern), ""); matchErr != nil {
+					err = fmt.Errorf("invalid --exclude pattern '%s': %v", pattern, matchErr)
+				}
+			}
+			config.Exclude = append(config.Exclude, pattern)
+		case "--graceful-shutdown":
+			config.GracefulShutdown = true
+		case "--shutdown-signal":
+			config.ShutdownSignal, err = flagValue(args, &i)
+		case "--shutdown-timeout":
+			config.ShutdownTimeout, err = intFlagValue(args, &i)
+		case "--force-kill":
+			config.ForceKill = true
+		case "--terminate-pid":
+			config.TerminatePID = true
+		case "--ignore":
+			var pattern string
+			if pattern, err = flagValue(args, &i); err == nil {
+				if _, matchErr := path.Match(filepath.ToSlash(pattern), ""); matchErr != nil {
+					err = fmt.Errorf("invalid --ignore pattern '%s': %v", pattern, matchErr)
+				}
+			}
+			config.Ignore = append(config.Ignore, pattern)
+		case "--exec-search-depth":
+			config.ExecSearchDepth, err = intFlagValue(args, &i)
+		case "--newer-only":
+			config.NewerOnly = true
+		case "--include-ext", "--exclude-ext":
+			var exts string
+			exts, err = flagValue(args, &i)
+			if arg == "--include-ext" {
+				config.IncludeExt = append(config.IncludeExt, strings.Split(exts, ",")...)
+			} else {
+				config.ExcludeExt = append(config.ExcludeExt, strings.Split(exts, ",")...)
+			}
+		case "--verify-source-readable":
+			config.VerifySourceReadable = true
+		case "--strict-identity":
+			config.StrictIdentity = true
+		case "--preserve-times", "--preserve-mtime":
+			config.PreserveMTime = true
+		case "--no-preserve-times":
+			config.NoPreserveTimes = true
+		case "--checksum-cache":
+			config.ChecksumCache, err = flagValue(args, &i)
+		case "--verify-during-copy":
+			config.VerifyDuringCopy = true
+		case "--verify-signature":
+			config.VerifySignature = true
+		case "--require-team-id":
+			config.RequireTeamID, err = flagValue(args, &i)
+			config.VerifySignature = true
+		case "--require-publisher":
+			config.RequirePublisher, err = flagValue(args, &i)
+			config.VerifySignature = true
+		case "--pre-update-cmd":
+			config.PreUpdateCmd, err = flagValue(args, &i)
+		case "--post-update-cmd":
+			config.PostUpdateCmd, err = flagValue(args, &i)
+		case "--rollback-on-hook-failure":
+			config.RollbackOnHookFailure = true
+		case "--update-marker":
+			config.UpdateMarker, err = flagValue(args, &i)
+		case "--verify-pid-owns-path":
+			config.VerifyPIDOwnsPath = true
+		case "--strict-pid-check":
+			config.VerifyPIDOwnsPath = true
+			config.StrictPIDCheck = true
+		case "--verify-running-binary":
+			config.VerifyRunningBinary = true
+		case "--compare-versions":
+			config.CompareVersions = true
+		case "--allow-downgrade":
+			config.AllowDowngrade = true
+		case "--version-file":
+			config.VersionFile, err = flagValue(args, &i)
+		case "--clear-quarantine":
+			config.ClearQuarantine = true
+		case "--refresh-shortcuts":
+			config.RefreshShortcuts = true
+		case "--harden":
+			config.Harden = true
+		case "--dry-run":
+			config.DryRun = true
+		case "--pid-file":
+			config.PIDFile, err = flagValue(args, &i)
+		case "--json-summary":
+			config.JSONSummary = true
+		case "--force":
+			config.Force = true
+		case "--allow-single-file":
+			config.AllowSingleFile = true
+		case "--auto-wrap-bundle":
+			config.AutoWrapBundle = true
+		case "--fail-fast":
+			config.FailFast = true
+		case "--swap":
+			config.Swap = true
+		case "--require-writable":
+			config.RequireWritable = true
+		case "--delta":
+			config.Delta = true
+		case "--backup-dir":
+			config.BackupDir, err = flagValue(args, &i)
+		case "--tmp-dir":
+			config.TmpDir, err = flagValue(args, &i)
+		case "--min-free-bytes":
+			var value string
+			if value, err = flagValue(args, &i); err == nil {
+				config.MinFreeBytes, err = strconv.ParseInt(value, 10, 64)
+				if err != nil || config.MinFreeBytes < 0 {
+					err = fmt.Errorf("invalid value '%s' for option %s", value, arg)
+				}
+			}
+		case "--backup-mode":
+			config.BackupMode, err = flagValue(args, &i)
+		case "--no-launch":
+			config.NoLaunch = true
+		case "--allow-self-update":
+			config.AllowSelfUpdate = true
+		case "--copy-concurrency":
+			config.CopyConcurrency, err = intFlagValue(args, &i)
+		case "--copy-buffer-size":
+			config.CopyBufferSize, err = intFlagValue(args, &i)
+		case "--max-copy-rate":
+			var value string
+			if value, err = flagValue(args, &i); err == nil {
+				config.MaxCopyRate, err = strconv.ParseInt(value, 10, 64)
+				if err != nil || config.MaxCopyRate < 0 {
+					err = fmt.Errorf("invalid value '%s' for option %s", value, arg)
+				}
+			}
+		case "--resumable":
+			config.Resumable = true
+		case "--best-effort":
+			config.BestEffort = true
+		case "--max-failures":
+			config.MaxFailures, err = intFlagValue(args, &i)
+			config.BestEffort = true
+		case "--subprocess-timeout":
+			config.SubprocessTimeout, err = intFlagValue(args, &i)
+		case "--copy-file-range":
+			config.CopyFileRange = true
+		case "--retry-attempts":
+			config.RetryAttempts, err = intFlagValue(args, &i)
+		case "--retry-backoff":
+			config.RetryBackoffMS, err = intFlagValue(args, &i)
+		case "--log-level":
+			config.LogLevel, err = flagValue(args, &i)
+		case "--log-format":
+			config.LogFormat, err = flagValue(args, &i)
+		case "--log-file":
+			config.LogFile, err = flagValue(args, &i)
+		case "--quiet", "-q":
+			config.Quiet = true
+		case "--silent":
+			config.Silent = true
+		case "--no-log-file":
+			config.NoLogFile = true
+		case "--append-log":
+			config.AppendLog = true
+		default:
+			return nil, fmt.Errorf("unknown option '%s'. Use '%s --help' for usage information", arg, args[0])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case len(positional) == 3:
+		pid, err := strconv.Atoi(positional[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid PID '%s': %v", positional[0], err)
+		}
+		config.PID = pid
+		config.CurrentPath = positional[1]
+		config.NewPath = positional[2]
+	case len(positional) == 2 && (config.WaitProcessName != "" || config.NoWait):
+		// Nothing to wait for by PID
+		config.CurrentPath = positional[0]
+		config.NewPath = positional[1]
+	case len(positional) == 0 && configFile != "":
+		// Everything comes from the config file
+	default:
+		return nil, fmt.Errorf("invalid arguments. Use '%s --help' for usage information", args[0])
+	}
+
+	// Paths may refer to ${VAR} and ~, whether given here or in the config file
+	var err error
+	if config.CurrentPath, err = expandPath(config.CurrentPath); err != nil {
+		return nil, err
+	}
+	if config.NewPath, err = expandPath(config.NewPath); err != nil {
+		return nil, err
+	}
+	if config.AppName, err = expandEnv(config.AppName); err != nil {
+		return nil, err
+	}
+
+	if err := config.normalize(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// flagValue returns the value that follows the option at args[*i] and advances past it
+func flagValue(args []string, i *int) (string, error) {
+	if *i+1 >= len(args) {
+		return "", fmt.Errorf("option %s requires a value", args[*i])
+	}
+	*i++
+	return args[*i], nil
+}
+
+// intFlagValue is flagValue for options that take a non-negative integer
+func intFlagValue(args []string, i *int) (int, error) {
+	name := args[*i]
+	value, err := flagValue(args, i)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid value '%s' for option %s", value, name)
+	}
+	return n, nil
+}
+
+// showUsage displays brief usage information
+func showUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [options] <pid> <current_dir> <new_dir> [--app-name <name>]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Options:\n")
+	fmt.Fprintf(os.Stderr, "  -v, --version    Show version information\n")
+	fmt.Fprintf(os.Stderr, "  -h, --help       Show this help message\n")
+	fmt.Fprintf(os.Stderr, "\nNote: Both current_dir and new_dir must be directories (not files or .app bundles)\n")
+}
+
+// showHelp displays detailed help information
+func showHelp() {
+	fmt.Fprintf(os.Stderr, "atom-updater %s - Directory-based application updater with atomic replacement\n\n", Version)
+	fmt.Fprintf(os.Stderr, "Usage: %s [options] <pid> <current_dir> <new_dir> [--app-name <name>]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s --wait-process-name <name> [options] <current_dir> <new_dir>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s --config <file.json> [options] [<pid> <current_dir> <new_dir>]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s --version\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s clean <dir> [--dry-run]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s detect <path> [--app-name <name>] [--json]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s list-executables <dir> [--app-name <name>] [--json]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s --recover <current_dir>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s --rollback <backup_dir> <current_dir>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\nOptions:\n")
+	fmt.Fprintf(os.Stderr, "  -v, --version    Show version information\n")
+	fmt.Fprintf(os.Stderr, "  -h, --help       Show this help message\n")
+	fmt.Fprintf(os.Stderr, "\nParameters:\n")
+	fmt.Fprintf(os.Stderr, "  <pid>            Process ID to wait for exit (0 = don't wait)\n")
+	fmt.Fprintf(os.Stderr, "  <current_dir>    Path to current application directory (must be directory)\n")
+	fmt.Fprintf(os.Stderr, "  <new_dir>        Path to new application directory (must be directory), or a .zip/.tar.gz archive of it\n")
+	fmt.Fprintf(os.Stderr, "  --config <path>  Optional: Load options from a JSON file, or stdin with '-' (command-line values override it)\n")
+	fmt.Fprintf(os.Stderr, "  --app-name <name> Optional: Name of executable to launch (for directories); a comma-separated list is tried in order\n")
+	fmt.Fprintf(os.Stderr, "  --timeout <sec>  Optional: Seconds to wait for the process to exit (default 0 = wait forever)\n")
+	fmt.Fprintf(os.Stderr, "  --wait-process-name <name> Optional: Wait for every process with this executable name, instead of or besides <pid>\n")
+	fmt.Fprintf(os.Stderr, "  --no-wait        Optional: Don't wait for any process (<pid> may then be omitted)\n")
+	fmt.Fprintf(os.Stderr, "  --timeout-action <proceed|abort|kill|terminate> Optional: What to do when --timeout expires (default proceed)\n")
+	fmt.Fprintf(os.Stderr, "  --timeout-exit-code <n> Optional: Exit code when the update is abandoned on --timeout (default 5)\n")
+	fmt.Fprintf(os.Stderr, "  --checksum <sha256> Optional: Expected SHA256 of the new version's executable (implies --verify-checksum)\n")
+	fmt.Fprintf(os.Stderr, "  --verify-checksum Optional: Verify new_dir against --checksum and/or new_dir/checksums.txt before replacing\n")
+	fmt.Fprintf(os.Stderr, "  --verify-after-copy Optional: Compare the installed files with new_dir (sizes, or SHA256 with --verify-checksum) before removing the backup\n")
+	fmt.Fprintf(os.Stderr, "  --health-check-url <url> Optional: Roll back unless this URL returns 200 after launch\n")
+	fmt.Fprintf(os.Stderr, "  --health-check-timeout <sec> Optional: Seconds to wait for a healthy response (default --timeout, else 30)\n")
+	fmt.Fprintf(os.Stderr, "  --launch-verify-seconds <n> Optional: Roll back if the relaunched app exits within n seconds\n")
+	fmt.Fprintf(os.Stderr, "  --watchdog-timeout <sec> Optional: Roll back unless the relaunched app stays up or passes --health-check-url within this time\n")
+	fmt.Fprintf(os.Stderr, "  --progress-fd <n> Optional: Stream copy progress as JSON lines to this file descriptor (1 = stdout)\n")
+	fmt.Fprintf(os.Stderr, "  --progress-file <path> Optional: Stream copy progress as JSON lines to this file\n")
+	fmt.Fprintf(os.Stderr, "  --keep-backup    Optional: Keep the previous version beside current_dir (or in --backup-dir) and print its path\n")
+	fmt.Fprintf(os.Stderr, "  --max-backups <n> Optional: Kept backups to retain, oldest pruned first (default 3)\n")
+	fmt.Fprintf(os.Stderr, "  --handoff-socket <path> Optional: Coordinate a live handoff with the running app via this socket (not on Windows)\n")
+	fmt.Fprintf(os.Stderr, "  --handoff-timeout <sec> Optional: Seconds the running app has to hand off and exit (default 30)\n")
+	fmt.Fprintf(os.Stderr, "  --verbose        Optional: Log debug details such as rename/copy decisions\n")
+	fmt.Fprintf(os.Stderr, "  --make-executable <glob> Optional, repeatable: Files to chmod +x after the update\n")
+	fmt.Fprintf(os.Stderr, "  --require-path <relpath> Optional, repeatable: Path that must exist in the new version (rolls back if missing after update)\n")
+	fmt.Fprintf(os.Stderr, "  --preserve <glob>        Optional, repeatable: Path under current_dir left untouched by the update, e.g. user data\n")
+	fmt.Fprintf(os.Stderr, "  --exclude <glob>         Optional, repeatable: Path deleted from current_dir instead of backed up, and not copied from new_dir, e.g. caches\n")
+	fmt.Fprintf(os.Stderr, "  --graceful-shutdown Optional: Ask the process to quit before waiting for it\n")
+	fmt.Fprintf(os.Stderr, "  --shutdown-signal <sig> Optional: Signal to send (default SIGTERM; WM_CLOSE or event:<name> on Windows)\n")
+	fmt.Fprintf(os.Stderr, "  --shutdown-timeout <sec> Optional: Seconds to wait after the shutdown request (default 10)\n")
+	fmt.Fprintf(os.Stderr, "  --force-kill     Optional: Force-kill the process if it ignores the shutdown request\n")
+	fmt.Fprintf(os.Stderr, "  --terminate-pid  Optional: Ask the process to quit, then force-kill it; with --timeout, only once that expires\n")
+	fmt.Fprintf(os.Stderr, "  --exec-search-depth <n> Optional: Directory levels searched for executables (default unlimited)\n")
+	fmt.Fprintf(os.Stderr, "  --ignore <glob>  Optional: Never launch executables matching the glob (repeatable)\n")
+	fmt.Fprintf(os.Stderr, "  --newer-only     Optional: Only copy files whose mtime is newer than the installed copy\n")
+	fmt.Fprintf(os.Stderr, "  --include-ext <.ext,...> Optional, repeatable: Only copy files with these extensions\n")
+	fmt.Fprintf(os.Stderr, "  --exclude-ext <.ext,...> Optional, repeatable: Never copy files with these extensions\n")
+	fmt.Fprintf(os.Stderr, "  --verify-source-readable Optional: Read every file of the new version before replacing\n")
+	fmt.Fprintf(os.Stderr, "  --strict-identity Optional: Abort if the bundle identifier / product name changes (default: warn)\n")
+	fmt.Fprintf(os.Stderr, "  --no-preserve-times Optional: Give copied files the time of the copy instead of the source access and modification times\n")
+	fmt.Fprintf(os.Stderr, "  --checksum-cache <path> Optional: Reuse SHA256 hashes of files whose size and mtime are unchanged since an earlier run\n")
+	fmt.Fprintf(os.Stderr, "  --verify-during-copy Optional: Verify files against new_dir/checksums.txt while copying (rolls back on mismatch)\n")
+	fmt.Fprintf(os.Stderr, "  --verify-signature Optional (macOS, Windows): Abort unless the new version is validly signed (codesign / Authenticode)\n")
+	fmt.Fprintf(os.Stderr, "  --require-team-id <id> Optional (macOS): Also require this signing team ID (implies --verify-signature)\n")
+	fmt.Fprintf(os.Stderr, "  --require-publisher <name> Optional (Windows): Also require this certificate CN or O (implies --verify-signature)\n")
+	fmt.Fprintf(os.Stderr, "  --pre-update-cmd <cmd> Optional: Shell command to run before anything is changed; a non-zero exit cancels the update\n")
+	fmt.Fprintf(os.Stderr, "  --post-update-cmd <cmd> Optional: Shell command to run in current_dir after the replace, before launch\n")
+	fmt.Fprintf(os.Stderr, "  --rollback-on-hook-failure Optional: Roll back when --post-update-cmd exits non-zero\n")
+	fmt.Fprintf(os.Stderr, "  --update-marker <path> Optional: Write a JSON marker for the relaunched app (relative to current_dir)\n")
+	fmt.Fprintf(os.Stderr, "  --verify-pid-owns-path Optional: Warn unless <pid> runs an executable inside current_dir\n")
+	fmt.Fprintf(os.Stderr, "  --strict-pid-check Optional: Refuse the update unless <pid> runs an executable inside current_dir\n")
+	fmt.Fprintf(os.Stderr, "  --verify-running-binary Optional (Linux): Fail unless the relaunched process runs the updated binary\n")
+	fmt.Fprintf(os.Stderr, "  --compare-versions Optional: Refuse the update unless the new version is newer (semver in the version file)\n")
+	fmt.Fprintf(os.Stderr, "  --allow-downgrade Optional: With --compare-versions, install an older or equal version anyway\n")
+	fmt.Fprintf(os.Stderr, "  --version-file <path> Optional: Version file relative to each app directory (default version.txt)\n")
+	fmt.Fprintf(os.Stderr, "  --clear-quarantine Optional (macOS): Remove com.apple.quarantine from the installed files before launch\n")
+	fmt.Fprintf(os.Stderr, "  --refresh-shortcuts Optional (Windows): Point Start menu, desktop and taskbar shortcuts at the new executable\n")
+	fmt.Fprintf(os.Stderr, "  --harden         Optional: Make key files read-only/immutable and verify them before launch (undone by the next update)\n")
+	fmt.Fprintf(os.Stderr, "  --dry-run        Optional: Run all checks and print the update plan without modifying anything\n")
+	fmt.Fprintf(os.Stderr, "  --pid-file <path> Optional: Write the PID of the launched application to <path>\n")
+	fmt.Fprintf(os.Stderr, "  --json-summary   Optional: Print a JSON summary of the run to stdout when it ends\n")
+	fmt.Fprintf(os.Stderr, "  --allow-single-file Optional: Accept a single executable file as current_app and new_app\n")
+	fmt.Fprintf(os.Stderr, "  --auto-wrap-bundle Optional (macOS): Accept MyApp.app as current_dir or new_dir and update only that bundle\n")
+	fmt.Fprintf(os.Stderr, "  --fail-fast      Optional: With a current_dir pattern, stop at the first install that fails to update\n")
+	fmt.Fprintf(os.Stderr, "  --swap           Optional: Assemble the new version beside current_dir and swap the directories with two renames\n")
+	fmt.Fprintf(os.Stderr, "  --require-writable Optional: Refuse the update up front if current_dir (or --backup-dir) is not writable\n")
+	fmt.Fprintf(os.Stderr, "  --force          Optional: Allow replacing a single file with a directory or the reverse\n")
+	fmt.Fprintf(os.Stderr, "  --delta          Optional: Only copy changed files and delete removed ones (size+mtime, or SHA256 with checksums)\n")
+	fmt.Fprintf(os.Stderr, "  --backup-dir <path> Optional: Keep the in-progress backup under <path> instead of inside current_dir\n")
+	fmt.Fprintf(os.Stderr, "  --tmp-dir <path> Optional: Make intermediate copies and, without --backup-dir, the backup under <path>\n")
+	fmt.Fprintf(os.Stderr, "  --min-free-bytes <n> Optional: Free space to leave on current_dir's volume beyond the files copied (default 0)\n")
+	fmt.Fprintf(os.Stderr, "  --backup-mode <octal> Optional: Permissions of the backup directory (default 0700)\n")
+	fmt.Fprintf(os.Stderr, "  --no-launch      Optional: Replace the application but do not start it afterwards\n")
+	fmt.Fprintf(os.Stderr, "  --allow-self-update Optional: Proceed even though the updater runs from inside current_dir or new_dir\n")
+	fmt.Fprintf(os.Stderr, "  --copy-concurrency <n> Optional: Files copied in parallel (default: number of CPUs, 1 = one at a time)\n")
+	fmt.Fprintf(os.Stderr, "  --copy-buffer-size <bytes> Optional: Buffer size for copying file contents (default 1048576)\n")
+	fmt.Fprintf(os.Stderr, "  --max-copy-rate <bytes/sec> Optional: Limit how fast file contents are copied, all copies together (default 0, unlimited)\n")
+	fmt.Fprintf(os.Stderr, "  --copy-file-range Optional (Linux): Let the kernel copy file contents (copy_file_range) where possible\n")
+	fmt.Fprintf(os.Stderr, "  --resumable      Optional: Record copied files so an interrupted copy is resumed by a rerun or --recover\n")
+	fmt.Fprintf(os.Stderr, "  --best-effort    Optional: Leave out files that cannot be copied (e.g. locked) instead of rolling back\n")
+	fmt.Fprintf(os.Stderr, "  --max-failures <n> Optional: Roll back once more than <n> files could not be copied (implies --best-effort)\n")
+	fmt.Fprintf(os.Stderr, "  --subprocess-timeout <sec> Optional: Kill a helper command such as ditto or codesign after this long (default 120)\n")
+	fmt.Fprintf(os.Stderr, "  --retry-attempts <n> Optional (Windows): Tries for a file operation while the file is in use (default: 5)\n")
+	fmt.Fprintf(os.Stderr, "  --retry-backoff <ms> Optional (Windows): Wait before the first retry, doubled each time (default: 100)\n")
+	fmt.Fprintf(os.Stderr, "  --quiet, -q      Optional: Only print errors to the console; the log file is unaffected\n")
+	fmt.Fprintf(os.Stderr, "  --silent         Optional: Log nothing and write no log file; report through the exit code (and --json-summary)\n")
+	fmt.Fprintf(os.Stderr, "  --log-level <debug|info|warn|error> Optional: Least severe messages to log (default: info)\n")
+	fmt.Fprintf(os.Stderr, "  --log-format <text|json> Optional: Log as plain text (default) or one JSON object per line\n")
+	fmt.Fprintf(os.Stderr, "  --log-file <path> Optional: Write the log here instead of atom-updater.log next to the executable\n")
+	fmt.Fprintf(os.Stderr, "  --no-log-file    Optional: Log to the console only\n")
+	fmt.Fprintf(os.Stderr, "  --append-log     Optional: Append to the log file instead of truncating it at startup\n")
+	fmt.Fprintf(os.Stderr, "\nCommands:\n")
+	fmt.Fprintf(os.Stderr, "  clean <dir>      Remove leftover updater artifacts (backups, bundle temps) from <dir>\n")
+	fmt.Fprintf(os.Stderr, "                   --dry-run lists what would be removed without deleting\n")
+	fmt.Fprintf(os.Stderr, "  --rollback <backup_dir> <current_dir> Restore a backup kept by --keep-backup\n")
+	fmt.Fprintf(os.Stderr, "  --recover <dir>  Finish or undo an update of <dir> that was interrupted (uses the journal next to <dir>)\n")
+	fmt.Fprintf(os.Stderr, "\n⚠️  Restrictions:\n")
+	fmt.Fprintf(os.Stderr, "  - Both current_dir and new_dir MUST be directories\n")
+	fmt.Fprintf(os.Stderr, "  - Single files (like .exe) are NOT allowed (unless --allow-single-file)\n")
+	fmt.Fprintf(os.Stderr, "  - .app bundles are NOT allowed as direct arguments (unless --auto-wrap-bundle)\n")
+	fmt.Fprintf(os.Stderr, "\nExamples:\n")
+	fmt.Fprintf(os.Stderr, "  # macOS directory containing .app bundles\n")
+	fmt.Fprintf(os.Stderr, "  %s 12345 ./test/myapp ./test/updates/macapp\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\n  # Windows directory with specific exe\n")
+	fmt.Fprintf(os.Stderr, "  %s 12345 ./MyApp/ ./updates/MyApp/ --app-name app.exe\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\nSupported application types:\n")
+	fmt.Fprintf(os.Stderr, "  - macOS directories containing .app bundles ✨\n")
+	fmt.Fprintf(os.Stderr, "  - macOS directories with executables\n")
+	fmt.Fprintf(os.Stderr, "  - Windows directories with executables\n")
+	fmt.Fprintf(os.Stderr, "  - Linux directories with executables\n")
+}
@@ -0,0 +1,175 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+)
+
+// stdinConfigPath is the --config value that reads the configuration from standard input
+const stdinConfigPath = "-"
+
+// loadConfigFile fills config from a JSON file using the UpdateConfig field tags,
+// or from standard input when configPath is "-", so a parent process can pipe the
+// configuration in without leaving it on disk. Unknown fields are rejected so a
+// misspelled option doesn't silently do nothing.
+func loadConfigFile(configPath string, config *UpdateConfig) error {
+	var input io.Reader = os.Stdin
+	if configPath != stdinConfigPath {
+		file, err := os.Open(configPath)
+		if err != nil {
+			return fmt.Errorf("failed to open config file: %v", err)
+		}
+		defer file.Close()
+		input = file
+	} else {
+		configPath = "from standard input"
+	}
+
+	decoder := json.NewDecoder(input)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", configPath, err)
+	}
+	return nil
+}
+
+// normalize checks config for missing or conflicting settings and resolves its
+// paths to absolute ones. It is safe to call more than once.
+func (c *UpdateConfig) normalize() error {
+	if c.PID < 0 {
+		return fmt.Errorf("invalid pid %d (use 0 or --no-wait to skip waiting)", c.PID)
+	}
+	if c.NoWait && c.WaitProcessName != "" {
+		return fmt.Errorf("--no-wait cannot be combined with --wait-process-name")
+	}
+	if c.HandoffSocket != "" && runtime.GOOS == "windows" {
+		return fmt.Errorf("--handoff-socket is not supported on Windows: the running instance keeps its files open, so they cannot be replaced")
+	}
+	if c.HandoffSocket != "" && c.PID == 0 {
+		return fmt.Errorf("--handoff-socket requires the pid of the running instance")
+	}
+	if c.HandoffTimeout < 0 {
+		return fmt.Errorf("invalid --handoff-timeout %d (expected a positive number of seconds)", c.HandoffTimeout)
+	}
+	if c.CurrentPath == "" || c.NewPath == "" {
+		return fmt.Errorf("current_path and new_path are required in the config file")
+	}
+	switch c.TimeoutAction {
+	case "", timeoutActionProceed, timeoutActionAbort, timeoutActionKill, timeoutActionTerminate:
+	default:
+		return fmt.Errorf("invalid timeout action '%s' (expected proceed, abort, kill or terminate)", c.TimeoutAction)
+	}
+	if c.PreserveMTime && c.NoPreserveTimes {
+		return fmt.Errorf("--no-preserve-times cannot be combined with --preserve-times")
+	}
+	if c.TerminatePID {
+		if c.PID == 0 && c.WaitProcessName == "" {
+			return fmt.Errorf("--terminate-pid requires a pid or --wait-process-name")
+		}
+		// With --timeout the process gets that long to quit on its own first
+		if c.Timeout > 0 {
+			if c.TimeoutAction != "" && c.TimeoutAction != timeoutActionTerminate {
+				return fmt.Errorf("--terminate-pid cannot be combined with --timeout-action %s", c.TimeoutAction)
+			}
+			c.TimeoutAction = timeoutActionTerminate
+		} else {
+			c.GracefulShutdown = true
+			c.ForceKill = true
+		}
+	}
+	if c.CopyConcurrency < 0 {
+		return fmt.Errorf("invalid --copy-concurrency %d (expected a positive number)", c.CopyConcurrency)
+	}
+	if c.CopyBufferSize < 0 {
+		return fmt.Errorf("invalid --copy-buffer-size %d (expected a positive number of bytes)", c.CopyBufferSize)
+	}
+	if c.MaxCopyRate < 0 {
+		return fmt.Errorf("invalid --max-copy-rate %d (expected bytes per second, 0 for unlimited)", c.MaxCopyRate)
+	}
+	if c.MaxFailures < 0 {
+		return fmt.Errorf("invalid --max-failures %d (expected a positive number of files)", c.MaxFailures)
+	}
+	if c.MaxFailures > 0 {
+		c.BestEffort = true
+	}
+	if c.SubprocessTimeout < 0 {
+		return fmt.Errorf("invalid --subprocess-timeout %d (expected a positive number of seconds)", c.SubprocessTimeout)
+	}
+	if c.TimeoutExitCode > 255 {
+		return fmt.Errorf("invalid --timeout-exit-code %d (expected 1-255)", c.TimeoutExitCode)
+	}
+	if c.Silent && (c.LogFile != "" || c.AppendLog) {
+		return fmt.Errorf("--silent writes no log file and cannot be combined with --log-file or --append-log")
+	}
+	if c.LogLevel != "" {
+		if _, ok := parseLogLevel(c.LogLevel); !ok {
+			return fmt.Errorf("invalid log level '%s' (expected debug, info, warn or error)", c.LogLevel)
+		}
+	}
+	switch c.LogFormat {
+	case "", logFormatText, logFormatJSON:
+	default:
+		return fmt.Errorf("invalid log format '%s' (expected text or json)", c.LogFormat)
+	}
+	if c.BackupMode != "" {
+		if mode, err := strconv.ParseUint(c.BackupMode, 8, 32); err != nil || mode > 0777 {
+			return fmt.Errorf("invalid backup mode '%s' (expected octal permissions such as 0700)", c.BackupMode)
+		}
+	}
+	if c.WatchdogTimeout > 0 && c.LaunchVerifySeconds > 0 {
+		return fmt.Errorf("--watchdog-timeout already watches the relaunched process and cannot be combined with --launch-verify-seconds")
+	}
+	if c.NoLaunch && (c.HealthCheckURL != "" || c.LaunchVerifySeconds > 0 || c.WatchdogTimeout > 0 ||
+		c.VerifyRunningBinary || c.HandoffSocket != "") {
+		return fmt.Errorf("--no-launch cannot be combined with options that check the relaunched app")
+	}
+
+	// Resolve paths to absolute paths
+	absCurrentPath, err := filepath.Abs(c.CurrentPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve current path '%s': %v", c.CurrentPath, err)
+	}
+
+	absNewPath, err := filepath.Abs(c.NewPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve new path '%s': %v", c.NewPath, err)
+	}
+
+	c.CurrentPath = absCurrentPath
+	c.NewPath = absNewPath
+
+	if c.PIDFile != "" {
+		if c.PIDFile, err = filepath.Abs(c.PIDFile); err != nil {
+			return fmt.Errorf("failed to resolve PID file path: %v", err)
+		}
+	}
+
+	if c.BackupDir != "" {
+		if c.BackupDir, err = filepath.Abs(c.BackupDir); err != nil {
+			return fmt.Errorf("failed to resolve backup directory: %v", err)
+		}
+		// The backup would be moved into itself or copied as part of the new version
+		for _, root := range []string{c.CurrentPath, c.NewPath} {
+			if isPathWithin(c.BackupDir, root) {
+				return fmt.Errorf("backup directory %s must be outside %s", c.BackupDir, root)
+			}
+		}
+	}
+
+	if c.TmpDir != "" {
+		if c.TmpDir, err = filepath.Abs(c.TmpDir); err != nil {
+			return fmt.Errorf("failed to resolve temp directory: %v", err)
+		}
+		for _, root := range []string{c.CurrentPath, c.NewPath} {
+			if isPathWithin(c.TmpDir, root) {
+				return fmt.Errorf("temp directory %s must be outside %s", c.TmpDir, root)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package updater
+
+import (
+	"hash"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// defaultCopyBufferSize is the buffer used to copy file contents, large enough
+// that big binaries on fast disks are not copied in many small reads
+const defaultCopyBufferSize = 1 << 20
+
+var (
+	// copyBufferSize is the size of the buffers copyFileContent uses (--copy-buffer-size)
+	copyBufferSize = defaultCopyBufferSize
+	// useCopyFileRange lets the kernel copy file contents on Linux (--copy-file-range)
+	useCopyFileRange bool
+	// copyBuffers reuses copy buffers across files and concurrent copies
+	copyBuffers = sync.Pool{New: func() any {
+		buffer := make([]byte, copyBufferSize)
+		return &buffer
+	}}
+)
+
+// setCopyBufferSize changes the size of the copy buffers handed out from now on
+func setCopyBufferSize(size int) {
+	if size <= 0 || size == copyBufferSize {
+		return
+	}
+	copyBufferSize = size
+	copyBuffers = sync.Pool{New: func() any {
+		buffer := make([]byte, size)
+		return &buffer
+	}}
+}
+
+// copyFileContent copies src to dst, feeding the content into hash when it is
+// not nil. Without a hash and with --copy-file-range on Linux, the copy is done by
+// copy_file_range in the kernel, which Go falls back from when the files are on
+// different file systems; otherwise a pooled buffer of copyBufferSize is used.
+// With --max-copy-rate the content is always read through the rate limiter.
+func copyFileContent(dst, src *os.File, hash hash.Hash) error {
+	if hash == nil && useCopyFileRange && runtime.GOOS == "linux" && copyRateLimiter == nil {
+		_, err := dst.ReadFrom(src)
+		return err
+	}
+
+	var reader io.Reader = src
+	if copyRateLimiter != nil {
+		reader = &throttledReader{r: reader, limiter: copyRateLimiter}
+	}
+	if hash != nil {
+		reader = io.TeeReader(reader, hash)
+	}
+
+	buffer := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(buffer)
+
+	// Hide ReadFrom/WriteTo so io.CopyBuffer really uses our buffer
+	_, err := io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{reader}, *buffer)
+	return err
+}
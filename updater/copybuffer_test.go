@@ -0,0 +1,56 @@
+package updater
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// oldCopyBufferSize is the buffer io.Copy used before --copy-buffer-size
+const oldCopyBufferSize = 32 << 10
+
+func BenchmarkCopyLargeFile(b *testing.B) {
+	const size = 64 << 20
+	dir := b.TempDir()
+	src := filepath.Join(dir, "large.bin")
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		b.Fatal(err)
+	}
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		b.Fatal(err)
+	}
+	defer setCopyBufferSize(defaultCopyBufferSize)
+
+	for _, bufferSize := range []int{oldCopyBufferSize, defaultCopyBufferSize} {
+		b.Run(fmt.Sprintf("buffer=%dKiB", bufferSize>>10), func(b *testing.B) {
+			setCopyBufferSize(bufferSize)
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				if err := copyTestFile(src, filepath.Join(dir, "copy.bin")); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// copyTestFile copies src to dst with copyFileContent
+func copyTestFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if err := copyFileContent(out, in, nil); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
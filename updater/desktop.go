@@ -0,0 +1,178 @@
+package updater
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// desktopEntryDirs are where a Linux application directory keeps its .desktop
+// files, relative to the directory itself
+var desktopEntryDirs = []string{".", filepath.Join("share", "applications"), filepath.Join("usr", "share", "applications")}
+
+// desktopEntry is the launch information of a .desktop file
+type desktopEntry struct {
+	path string   // the .desktop file
+	args []string // Exec split into the program and its arguments, field codes removed
+	dir  string   // Path, the working directory to start in, or "" when unset
+}
+
+// findDesktopEntry returns the .desktop file the packager provided to start the
+// application in appPath, so wrapper scripts and environment settings are honoured.
+// With appNames only a file named after one of them is used, otherwise the first
+// application entry in name order. It returns nil when there is none.
+func findDesktopEntry(appPath string, appNames []string) *desktopEntry {
+	for _, dir := range desktopEntryDirs {
+		matches, _ := filepath.Glob(filepath.Join(appPath, dir, "*.desktop"))
+		sort.Strings(matches)
+		for _, match := range matches {
+			if len(appNames) > 0 && !matchesAppName(match, appNames) {
+				continue
+			}
+			entry, err := parseDesktopEntry(match)
+			if err != nil {
+				debugf("Ignoring %s: %v", match, err)
+				continue
+			}
+			if entry != nil {
+				return entry
+			}
+		}
+	}
+	return nil
+}
+
+// parseDesktopEntry reads the Exec and Path keys of the [Desktop Entry] group.
+// It returns nil for entries that are not applications.
+func parseDesktopEntry(path string) (*desktopEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	inEntry := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			inEntry = line == "[Desktop Entry]"
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok && inEntry {
+			key = strings.TrimSpace(key)
+			if _, seen := values[key]; !seen {
+				values[key] = strings.TrimSpace(value)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if entryType := values["Type"]; entryType != "" && entryType != "Application" {
+		return nil, nil
+	}
+	if values["Exec"] == "" {
+		return nil, fmt.Errorf("no Exec key in [Desktop Entry]")
+	}
+	args, err := splitDesktopExec(unescapeDesktopValue(values["Exec"]))
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("the Exec key names no program")
+	}
+
+	// A program given relative to the entry is resolved against its directory
+	if strings.ContainsRune(args[0], '/') && !filepath.IsAbs(args[0]) {
+		args[0] = filepath.Join(filepath.Dir(path), args[0])
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return nil, fmt.Errorf("program %s in Exec not found: %v", args[0], err)
+	}
+
+	return &desktopEntry{path: path, args: args, dir: unescapeDesktopValue(values["Path"])}, nil
+}
+
+// unescapeDesktopValue undoes the escapes allowed in any string value: \s, \n, \t, \r and \\
+func unescapeDesktopValue(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	return strings.NewReplacer(`\s`, " ", `\n`, "\n", `\t`, "\t", `\r`, "\r", `\\`, `\`).Replace(value)
+}
+
+// splitDesktopExec splits an Exec value into arguments. Arguments are separated by
+// spaces and may be double-quoted, with \ escaping the next character inside quotes.
+// Field codes such as %U or %f, which a desktop environment replaces with the files
+// or URLs being opened, are removed, and %% becomes %.
+func splitDesktopExec(value string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg, quoted := false, false
+
+	flush := func() {
+		if inArg {
+			if arg, ok := stripFieldCodes(current.String()); ok {
+				args = append(args, arg)
+			}
+		}
+		current.Reset()
+		inArg = false
+	}
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(value):
+			i++
+			current.WriteByte(value[i])
+		case quoted && c == '"':
+			quoted = false
+		case quoted:
+			current.WriteByte(c)
+		case c == '"':
+			quoted, inArg = true, true
+		case c == ' ' || c == '\t':
+			flush()
+		default:
+			current.WriteByte(c)
+			inArg = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in Exec %q", value)
+	}
+	flush()
+	return args, nil
+}
+
+// stripFieldCodes removes the field codes from arg. It reports false when nothing
+// is left of an argument that consisted of field codes only.
+func stripFieldCodes(arg string) (string, bool) {
+	if !strings.Contains(arg, "%") {
+		return arg, true
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(arg); i++ {
+		if arg[i] != '%' || i+1 == len(arg) {
+			b.WriteByte(arg[i])
+			continue
+		}
+		i++
+		if arg[i] == '%' {
+			b.WriteByte('%')
+		}
+	}
+	return b.String(), b.Len() > 0
+}
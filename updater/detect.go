@@ -0,0 +1,134 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// detectionReport is what `detect` found out about a path
+type detectionReport struct {
+	Path        string   `json:"path"`
+	Type        string   `json:"type"`
+	Executables []string `json:"executables"`
+	AppBundles  *bool    `json:"app_bundles,omitempty"` // macOS only
+	Launch      string   `json:"launch,omitempty"`      // what an update would start
+	LaunchError string   `json:"launch_error,omitempty"`
+}
+
+// runDetect implements `detect <path> [--app-name <name>] [--json]`: it reports how
+// an update would treat path, for diagnosing "incompatible application types"
+func runDetect(args []string) error {
+	var path, appName string
+	asJSON := false
+
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--json":
+			asJSON = true
+		case arg == "--app-name":
+			var err error
+			if appName, err = flagValue(args, &i); err != nil {
+				return err
+			}
+		case strings.HasPrefix(arg, "--"):
+			return fmt.Errorf("unknown option '%s' for detect", arg)
+		case path == "":
+			path = arg
+		default:
+			return fmt.Errorf("detect takes a single path")
+		}
+	}
+
+	if path == "" {
+		return fmt.Errorf("usage: %s detect <path> [--app-name <name>] [--json]", os.Args[0])
+	}
+
+	report, err := detectPath(path, appName)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Printf("Path:        %s\n", report.Path)
+	fmt.Printf("Type:        %s\n", report.Type)
+	if len(report.Executables) == 0 {
+		fmt.Printf("Executables: none\n")
+	} else {
+		fmt.Printf("Executables: %s\n", strings.Join(report.Executables, ", "))
+	}
+	if report.AppBundles != nil {
+		fmt.Printf("App bundles: %t\n", *report.AppBundles)
+	}
+	if report.LaunchError != "" {
+		fmt.Printf("Launch:      none (%s)\n", report.LaunchError)
+	} else {
+		fmt.Printf("Launch:      %s\n", report.Launch)
+	}
+	return nil
+}
+
+// detectPath runs the application type detection an update runs on path
+func detectPath(path, appName string) (*detectionReport, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve path '%s': %v", path, err)
+	}
+
+	appType, err := DetectApplicationType(absPath)
+	if err != nil {
+		return nil, err
+	}
+	report := &detectionReport{Path: absPath, Type: typeToString(appType), Executables: []string{}}
+
+	if isFileType(appType) {
+		if info, err := os.Stat(absPath); err == nil && isExecutable(info) {
+			report.Executables = append(report.Executables, filepath.Base(absPath))
+			report.Launch = absPath
+		} else {
+			report.LaunchError = "the file is not executable"
+		}
+		return report, nil
+	}
+
+	extension := ""
+	if runtime.GOOS == "windows" {
+		extension = ".exe"
+	}
+	if executables, err := findExecutablesInDirectory(absPath, extension); err == nil {
+		report.Executables = append(report.Executables, executables...)
+	}
+	if runtime.GOOS == "darwin" {
+		hasBundles, _ := containsAppBundles(absPath)
+		report.AppBundles = &hasBundles
+	}
+
+	appNames := appNameCandidates(appName)
+	if appType == LinuxAppDirectory {
+		if entry := findDesktopEntry(absPath, appNames); entry != nil {
+			report.Launch = fmt.Sprintf("%s (from %s)", strings.Join(entry.args, " "), entry.path)
+			return report, nil
+		}
+	}
+	if appType == MacAppBundleDirectory {
+		report.Launch = "first .app bundle, through open"
+		return report, nil
+	}
+	if launch, err := findExecutableInDirectory(absPath, appNames); err != nil {
+		report.LaunchError = err.Error()
+	} else {
+		report.Launch = launch
+	}
+	return report, nil
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package updater
+
+import "os"
+
+// syncDir flushes the entries of dir to disk, so a rename into or out of it
+// survives a power loss. Renaming only updates the directory, and without this
+// fsync the old name, or none, may come back after a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package updater
+
+// syncDir is a no-op on Windows: directories cannot be opened for flushing, and
+// NTFS journals renames as metadata changes, so a completed rename is not lost
+// on power failure the way an unsynced Unix directory entry can be
+func syncDir(dir string) error {
+	return nil
+}
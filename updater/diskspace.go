@@ -0,0 +1,33 @@
+package updater
+
+import "fmt"
+
+// bytesToCopy returns how many bytes the plan writes into the current directory
+func (p *updatePlan) bytesToCopy() int64 {
+	var total int64
+	for _, op := range p.Operations {
+		if op.Action == planCreate || op.Action == planReplace {
+			total += op.Size
+		}
+	}
+	return total
+}
+
+// checkFreeSpace fails unless the volume holding dir has room for needed bytes plus
+// minFree to spare. Running out halfway through the copy would leave the rollback
+// short of space as well. If free space cannot be determined the update goes ahead.
+func checkFreeSpace(dir string, needed, minFree int64) error {
+	available, err := freeDiskSpace(dir)
+	if err != nil {
+		warnf("Could not determine free space on the volume of %s, skipping the check: %v", dir, err)
+		return nil
+	}
+
+	infof("Free space on the volume of %s: %d bytes, update writes %d bytes (plus %d to spare)",
+		dir, available, needed, minFree)
+	if uint64(needed)+uint64(minFree) > available {
+		return fmt.Errorf("not enough free space on the volume of %s: %d bytes available, %d needed (%d to copy plus --min-free-bytes %d)",
+			dir, available, needed+minFree, needed, minFree)
+	}
+	return nil
+}
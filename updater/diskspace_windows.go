@@ -0,0 +1,30 @@
+//go:build windows
+
+package updater
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var procGetDiskFreeSpaceExW = kernel32.NewProc("GetDiskFreeSpaceExW")
+
+// freeDiskSpace returns the bytes available to the calling user on the volume holding path
+func freeDiskSpace(path string) (uint64, error) {
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var freeBytesAvailable, totalBytes, totalFreeBytes uint64
+	ret, _, err := procGetDiskFreeSpaceExW.Call(
+		uintptr(unsafe.Pointer(pathPtr)),
+		uintptr(unsafe.Pointer(&freeBytesAvailable)),
+		uintptr(unsafe.Pointer(&totalBytes)),
+		uintptr(unsafe.Pointer(&totalFreeBytes)),
+	)
+	if ret == 0 {
+		return 0, err
+	}
+	return freeBytesAvailable, nil
+}
@@ -0,0 +1,35 @@
+package updater
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors an update can fail with, for callers of Update to tell causes apart with
+// errors.Is. They are wrapped with context, so compare with errors.Is, never ==.
+// ExitCode maps them to the exit codes the command uses.
+var (
+	// ErrPathNotFound means current_dir or new_dir does not exist
+	ErrPathNotFound = errors.New("does not exist")
+
+	// ErrIncompatibleTypes means the new version cannot replace the current one,
+	// for example a directory and a single file
+	ErrIncompatibleTypes = errors.New("incompatible application types")
+
+	// ErrChecksumMismatch means a file's SHA256 differs from the expected one,
+	// in the new version or in the installed copy
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+
+	// ErrRollbackFailed means a failed update could not restore the previous
+	// version, which is then left in the backup named in the error
+	ErrRollbackFailed = errors.New("rollback failed")
+
+	// ErrCrossDevice means a rename failed because it crosses filesystems
+	ErrCrossDevice = errors.New("rename crosses filesystems")
+)
+
+// withRollbackFailure adds the failure to restore the previous version to err,
+// the failure that made the update roll back
+func withRollbackFailure(err, rollbackErr error) error {
+	return fmt.Errorf("%w (%w: %v)", err, ErrRollbackFailed, rollbackErr)
+}
@@ -0,0 +1,60 @@
+package updater
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ignorePatterns are the --ignore globs. Executables and directories matching
+// them, relative to the searched directory, are never considered for launch.
+var ignorePatterns []string
+
+// noiseExecutableNames are fragments of executable names that ship next to the
+// app but are not the app: uninstallers, crash reporters and helper processes
+var noiseExecutableNames = []string{"uninstall", "unins000", "crashpad", "crashreporter", "crash_handler", "helper"}
+
+// noiseDirectories hold support files rather than the launcher
+var noiseDirectories = []string{"locales", "swiftshader"}
+
+// isNoiseExecutable reports whether the executable at relPath is an uninstaller,
+// crash reporter, helper or other file that should not be launched as the app
+// when no --app-name picks one
+func isNoiseExecutable(relPath string) bool {
+	name := strings.ToLower(filepath.Base(relPath))
+	for _, fragment := range noiseExecutableNames {
+		if strings.Contains(name, fragment) {
+			return true
+		}
+	}
+
+	dirs := strings.Split(strings.ToLower(filepath.ToSlash(filepath.Dir(relPath))), "/")
+	for _, dir := range dirs {
+		for _, noise := range noiseDirectories {
+			if dir == noise {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// firstLaunchCandidate returns the executable to launch when no name was given:
+// the first that is not noise, or the first of all when every one is
+func firstLaunchCandidate(executables []string) string {
+	for _, exe := range executables {
+		if !isNoiseExecutable(exe) {
+			return exe
+		}
+		debugf("Skipping %s, it does not look like the application", exe)
+	}
+	return executables[0]
+}
+
+// sortByDepth orders relative paths so shallower ones come first, keeping the
+// walk order among paths at the same depth
+func sortByDepth(relPaths []string) {
+	sort.SliceStable(relPaths, func(i, j int) bool {
+		return pathDepth(relPaths[i]) < pathDepth(relPaths[j])
+	})
+}
@@ -0,0 +1,73 @@
+package updater
+
+import "errors"
+
+// Exit codes of an update run, so a caller can tell failure modes apart. The
+// command exits with them and ExitCode maps an Update error to them. They are
+// documented in the README and must not change.
+const (
+	ExitSuccess       = 0 // update completed, or help/version was shown
+	ExitUnexpected    = 1 // any failure not covered below
+	ExitBadArgs       = 2 // invalid command line, config file or paths
+	ExitIncompatible  = 3 // the new version cannot replace the current one
+	ExitReplaceFailed = 4 // replacement failed, the current version was left or put back
+	ExitWaitTimeout   = 5 // process still running after --timeout (default of --timeout-exit-code)
+	ExitHealthFailed  = 6 // relaunched app failed to start or verify and was rolled back
+	ExitCancelled     = 7 // cancelled (UpdateContext, or SIGINT/SIGTERM) before the new version was in place
+	ExitVetoed        = 8 // --pre-update-cmd exited non-zero, nothing was changed
+	ExitWatchdog      = 9 // relaunched app never became healthy within --watchdog-timeout and was rolled back
+)
+
+// exitError is an error that ends the run with a specific exit code
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// withExitCode tags err with the exit code it should end the run with.
+// A nil err stays nil.
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// ExitCode returns the exit code for an error returned by Update: 0 for nil,
+// otherwise one of the Exit* codes
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitSuccess
+	}
+	return exitCodeOf(err, ExitUnexpected)
+}
+
+// sentinelExitCodes are the exit codes of the Err* errors that are not tagged
+// with one where they occur
+var sentinelExitCodes = []struct {
+	err  error
+	code int
+}{
+	{ErrPathNotFound, ExitBadArgs},
+	{ErrIncompatibleTypes, ExitIncompatible},
+	{ErrChecksumMismatch, ExitReplaceFailed},
+	{ErrCrossDevice, ExitReplaceFailed},
+}
+
+// exitCodeOf returns the exit code err was tagged with, else that of the Err*
+// error it wraps, or fallback
+func exitCodeOf(err error, fallback int) int {
+	var tagged *exitError
+	if errors.As(err, &tagged) {
+		return tagged.code
+	}
+	for _, sentinel := range sentinelExitCodes {
+		if errors.Is(err, sentinel.err) {
+			return sentinel.code
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,49 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// envReference matches a ${VAR} reference in an argument
+var envReference = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// expandEnv replaces each ${VAR} in value with the variable's value. A variable
+// that is not set is an error, so a typo cannot silently turn a path into another one.
+// A bare $ is left alone, since it also appears in real paths such as C:\$Recycle.Bin.
+func expandEnv(value string) (string, error) {
+	var missing []string
+	expanded := envReference.ReplaceAllStringFunc(value, func(ref string) string {
+		name := envReference.FindStringSubmatch(ref)[1]
+		envValue, ok := os.LookupEnv(name)
+		if !ok || name == "" {
+			missing = append(missing, name)
+		}
+		return envValue
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s in '%s' is not set", strings.Join(missing, ", "), value)
+	}
+	return expanded, nil
+}
+
+// expandPath is expandEnv for paths, also replacing a leading ~ with the user's home directory
+func expandPath(path string) (string, error) {
+	expanded, err := expandEnv(path)
+	if err != nil {
+		return "", err
+	}
+
+	// ~/ works everywhere, ~\ on Windows too
+	if expanded == "~" || strings.HasPrefix(expanded, "~/") || strings.HasPrefix(expanded, "~"+string(filepath.Separator)) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("cannot expand ~ in '%s': %v", path, err)
+		}
+		expanded = filepath.Join(home, expanded[1:])
+	}
+	return expanded, nil
+}
@@ -0,0 +1,21 @@
+//go:build failinject
+
+package updater
+
+import (
+	"fmt"
+	"os"
+)
+
+// failAtEnvVar names the phase to fail at in failinject builds, for exercising
+// the rollback paths: backup, copy, finalize or launch
+const failAtEnvVar = "ATOM_UPDATER_FAIL_AT"
+
+// injectFailure returns an error when ATOM_UPDATER_FAIL_AT names phase
+func injectFailure(phase string) error {
+	if os.Getenv(failAtEnvVar) != phase {
+		return nil
+	}
+	infof("Injecting failure at phase '%s' (%s)", phase, failAtEnvVar)
+	return fmt.Errorf("injected failure at phase '%s'", phase)
+}
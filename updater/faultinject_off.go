@@ -0,0 +1,8 @@
+//go:build !failinject
+
+package updater
+
+// injectFailure never fails in regular builds; build with -tags failinject to enable it
+func injectFailure(phase string) error {
+	return nil
+}
@@ -0,0 +1,97 @@
+//go:build failinject
+
+package updater
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// snapshotTree describes every entry under root by relative path: its type,
+// permissions and, for files, content
+func snapshotTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	entries := make(map[string]string)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entry := info.Mode().String()
+		if info.Mode().IsRegular() {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			entry += " " + string(data)
+		}
+		entries[filepath.ToSlash(relPath)] = entry
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestInjectedFailuresRestoreCurrentDir(t *testing.T) {
+	t.Cleanup(func() { applyRunSettings(&UpdateConfig{}) })
+	tests := []struct {
+		phase    string
+		wantCode int
+	}{
+		{phaseBackup, ExitReplaceFailed},
+		{phaseCopy, ExitReplaceFailed},
+		{phaseFinalize, ExitReplaceFailed},
+		// A failed launch is only rolled back when the launch must be verified
+		{phaseLaunch, ExitHealthFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.phase, func(t *testing.T) {
+			root := t.TempDir()
+			current := filepath.Join(root, "app")
+			newDir := filepath.Join(root, "app-new")
+			for _, dir := range []string{current, newDir} {
+				if err := os.MkdirAll(filepath.Join(dir, "data"), 0755); err != nil {
+					t.Fatal(err)
+				}
+				writeExecutables(t, dir, "app")
+				for i := 0; i < 5; i++ {
+					path := filepath.Join(dir, "data", fmt.Sprintf("file%d.txt", i))
+					content := fmt.Sprintf("%s file %d", filepath.Base(dir), i)
+					if err := os.WriteFile(path, []byte(content), 0640); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if err := os.WriteFile(filepath.Join(current, "settings.json"), []byte(`{"old":true}`), 0600); err != nil {
+				t.Fatal(err)
+			}
+			want := snapshotTree(t, current)
+
+			t.Setenv(failAtEnvVar, tt.phase)
+			cfg := UpdateConfig{CurrentPath: current, NewPath: newDir, NoLaunch: true}
+			if tt.phase == phaseLaunch {
+				cfg = UpdateConfig{CurrentPath: current, NewPath: newDir, LaunchVerifySeconds: 1}
+			}
+			err := Update(cfg)
+			if code := ExitCode(err); code != tt.wantCode {
+				t.Errorf("Update failing at %s = %v with exit code %d, want exit code %d", tt.phase, err, code, tt.wantCode)
+			}
+			if got := snapshotTree(t, current); !reflect.DeepEqual(got, want) {
+				t.Errorf("current_dir after failing at %s:\n got %q\nwant %q", tt.phase, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+
+package updater
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileIdentity returns the device and inode numbers of path
+func fileIdentity(path string) (device, inode uint64, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, fmt.Errorf("no device information available for %s", path)
+	}
+
+	return uint64(stat.Dev), uint64(stat.Ino), nil
+}
+
+// isCrossDeviceError reports whether err is a rename failure across filesystems
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
@@ -0,0 +1,41 @@
+//go:build windows
+
+package updater
+
+import (
+	"errors"
+	"syscall"
+)
+
+// fileIdentity returns the volume serial number and file index of path,
+// the Windows equivalents of st_dev and st_ino
+func fileIdentity(path string) (device, inode uint64, err error) {
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// FILE_FLAG_BACKUP_SEMANTICS is required to open directories
+	handle, err := syscall.CreateFile(pathPtr, 0,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer syscall.CloseHandle(handle)
+
+	var info syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(handle, &info); err != nil {
+		return 0, 0, err
+	}
+
+	return uint64(info.VolumeSerialNumber), uint64(info.FileIndexHigh)<<32 | uint64(info.FileIndexLow), nil
+}
+
+// errorNotSameDevice is ERROR_NOT_SAME_DEVICE, returned when a move crosses volumes
+const errorNotSameDevice = syscall.Errno(17)
+
+// isCrossDeviceError reports whether err is a rename failure across volumes
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
@@ -0,0 +1,59 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Defaults for retrying file operations that fail because another process
+// (antivirus, the shell, the app's own last handles) still has the file open
+const (
+	defaultFileRetryAttempts = 5
+	defaultFileRetryBackoff  = 100 * time.Millisecond
+)
+
+var (
+	fileRetryAttempts = defaultFileRetryAttempts
+	fileRetryBackoff  = defaultFileRetryBackoff
+)
+
+// retryableFileOp runs fn up to attempts times, doubling the wait after each
+// failure, for as long as it fails because the file is in use. Other errors are
+// returned at once.
+func retryableFileOp(fn func() error, attempts int, backoff time.Duration) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= attempts || !isFileInUseError(err) {
+			return err
+		}
+		infof("File is in use, retrying in %v (attempt %d of %d): %v", backoff, attempt, attempts, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// retryFileOp runs fn with the configured retry attempts and backoff
+func retryFileOp(fn func() error) error {
+	return retryableFileOp(fn, fileRetryAttempts, fileRetryBackoff)
+}
+
+// renameRetrying is os.Rename, retried while the file is in use. A rename across
+// filesystems fails with ErrCrossDevice.
+func renameRetrying(src, dst string) error {
+	err := retryFileOp(func() error { return os.Rename(src, dst) })
+	if err != nil && isCrossDeviceError(err) {
+		return fmt.Errorf("%w: %w", ErrCrossDevice, err)
+	}
+	return err
+}
+
+// removeAllRetrying is os.RemoveAll, retried while a file is in use
+func removeAllRetrying(path string) error {
+	return retryFileOp(func() error { return os.RemoveAll(path) })
+}
+
+// copyFileRetrying is copyFile, retried while either file is in use
+func copyFileRetrying(src, dst string) error {
+	return retryFileOp(func() error { return copyFile(src, dst) })
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package updater
+
+// isFileInUseError is always false: open files do not block renames or removals here
+func isFileInUseError(err error) bool {
+	return false
+}
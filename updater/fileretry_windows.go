@@ -0,0 +1,17 @@
+//go:build windows
+
+package updater
+
+import (
+	"errors"
+	"syscall"
+)
+
+// errorSharingViolation is ERROR_SHARING_VIOLATION, which the syscall package does not define
+const errorSharingViolation syscall.Errno = 32
+
+// isFileInUseError reports whether err means another process holds the file open.
+// Access denied is included because it is what deleting a file with an open handle returns.
+func isFileInUseError(err error) bool {
+	return errors.Is(err, errorSharingViolation) || errors.Is(err, syscall.ERROR_ACCESS_DENIED)
+}
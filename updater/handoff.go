@@ -0,0 +1,87 @@
+package updater
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Live handoff contract
+//
+// Apps that can pass open file descriptors / listening sockets to a new
+// instance may ask the updater to coordinate a handoff instead of quitting
+// before the update. The old instance listens on a Unix domain socket and
+// passes its path with --handoff-socket. The updater then:
+//
+//  1. Replaces the application directory while the old instance keeps running
+//     (requires a platform that allows replacing in-use files, i.e. macOS/Linux).
+//  2. Launches the new instance with ATOM_UPDATER_HANDOFF_SOCKET set to the
+//     socket path so it knows where to collect the running state from.
+//  3. Connects to the socket and sends "HANDOFF <new-pid>\n".
+//  4. Waits for the old instance to reply "DONE\n" once the new instance has
+//     taken over, then waits for the old process to exit.
+//
+// Any other reply (e.g. "FAIL <reason>\n") or a timeout aborts the handoff.
+// How state is transferred between the two instances is up to the app.
+
+// handoffEnvVar tells the relaunched application where to find the old instance
+const handoffEnvVar = "ATOM_UPDATER_HANDOFF_SOCKET"
+
+// defaultHandoffTimeout bounds how long the old instance may take to hand off
+// and exit when --handoff-timeout is not given
+const defaultHandoffTimeout = 30 * time.Second
+
+// handoffSocket is the --handoff-socket of the update in progress. It is passed to
+// the applications the update launches, not set in the updater's own environment,
+// so it does not reach later updates or other children of a host process.
+var handoffSocket string
+
+// launchEnv returns the environment of an application the update launches: the
+// updater's own plus ATOM_UPDATER_HANDOFF_SOCKET in handoff mode, else nil to
+// inherit it unchanged
+func launchEnv() []string {
+	if handoffSocket == "" {
+		return nil
+	}
+	return append(os.Environ(), handoffEnvVar+"="+handoffSocket)
+}
+
+// performHandoff asks the old instance to hand off to newPID and waits for it to finish
+func performHandoff(socketPath string, oldPID, newPID int, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = defaultHandoffTimeout
+	}
+
+	infof("Requesting handoff from process %d to %d via %s", oldPID, newPID, socketPath)
+
+	conn, err := net.DialTimeout("unix", socketPath, timeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to handoff socket %s: %v", socketPath, err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return fmt.Errorf("failed to set handoff deadline: %v", err)
+	}
+
+	if _, err := fmt.Fprintf(conn, "HANDOFF %d\n", newPID); err != nil {
+		return fmt.Errorf("failed to send handoff request: %v", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("no handoff confirmation from process %d: %v", oldPID, err)
+	}
+
+	reply = strings.TrimSpace(reply)
+	if reply != "DONE" {
+		return fmt.Errorf("handoff rejected by process %d: %s", oldPID, reply)
+	}
+
+	infof("Handoff confirmed, waiting for process %d to exit", oldPID)
+	return waitForProcessExitWithTimeout(context.Background(), oldPID, timeout)
+}
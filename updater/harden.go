@@ -0,0 +1,158 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// hardenRecordName is written into a hardened installation so the next update
+// can undo the hardening before it moves files around
+const hardenRecordName = ".atom-updater-hardened"
+
+// hardenedFile is a file made read-only by --harden, with the mode it had before
+type hardenedFile struct {
+	Path string      `json:"path"`
+	Mode fs.FileMode `json:"mode"`
+}
+
+// hardenRecord lists what hardenInstallation changed
+type hardenRecord struct {
+	Immutable bool           `json:"immutable"`
+	Files     []hardenedFile `json:"files"`
+}
+
+// hardenInstallation makes the key files under root (executables, the checksum
+// manifest and the files it lists) read-only and, where the platform and our
+// privileges allow it, immutable. The changes are recorded so unhardenInstallation
+// can reverse them.
+func hardenInstallation(root string) error {
+	var checksums map[string]string
+	manifestPath := filepath.Join(root, checksumManifestName)
+	if _, err := os.Stat(manifestPath); err == nil {
+		if checksums, err = loadChecksumManifest(manifestPath); err != nil {
+			return err
+		}
+	}
+
+	var record hardenRecord
+	var paths []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != root && isUpdaterArtifact(d.Name()) {
+			return filepath.SkipDir // A backup kept for the health check
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		slashPath := filepath.ToSlash(relPath)
+		_, listed := checksums[slashPath]
+		if !listed && slashPath != checksumManifestName && !isExecutable(info) {
+			return nil
+		}
+
+		if err := os.Chmod(path, info.Mode().Perm()&^0222); err != nil {
+			return fmt.Errorf("failed to make %s read-only: %v", relPath, err)
+		}
+		record.Files = append(record.Files, hardenedFile{Path: slashPath, Mode: info.Mode().Perm()})
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		// Still record what was changed so the next update can undo it
+		writeHardenRecord(root, record)
+		return err
+	}
+
+	if err := setImmutable(paths, true); err != nil {
+		warnf("Files are read-only but could not be made immutable: %v", err)
+	} else {
+		record.Immutable = true
+	}
+
+	if err := writeHardenRecord(root, record); err != nil {
+		return err
+	}
+	infof("Hardened %d files in %s (immutable: %v)", len(record.Files), root, record.Immutable)
+	return nil
+}
+
+// unhardenInstallation reverses a previous hardenInstallation, if there was one
+func unhardenInstallation(root string) error {
+	if info, err := os.Stat(root); err == nil && !info.IsDir() {
+		return nil // A single-file install is never hardened
+	}
+
+	recordPath := filepath.Join(root, hardenRecordName)
+	data, err := os.ReadFile(recordPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read hardening record: %v", err)
+	}
+
+	var record hardenRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return fmt.Errorf("failed to parse hardening record %s: %v", recordPath, err)
+	}
+
+	infof("Reverting hardening of %d files in %s", len(record.Files), root)
+	paths := make([]string, 0, len(record.Files))
+	for _, file := range record.Files {
+		paths = append(paths, filepath.Join(root, filepath.FromSlash(file.Path)))
+	}
+
+	if record.Immutable {
+		if err := setImmutable(paths, false); err != nil {
+			return fmt.Errorf("failed to clear immutable flags: %v", err)
+		}
+	}
+
+	for i, file := range record.Files {
+		if err := os.Chmod(paths[i], file.Mode); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to restore permissions of %s: %v", file.Path, err)
+		}
+	}
+
+	if err := os.Remove(recordPath); err != nil {
+		return fmt.Errorf("failed to remove hardening record: %v", err)
+	}
+	return nil
+}
+
+// writeHardenRecord stores record in root
+func writeHardenRecord(root string, record hardenRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode hardening record: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, hardenRecordName), data, 0644); err != nil {
+		return fmt.Errorf("failed to write hardening record: %v", err)
+	}
+	return nil
+}
+
+// verifyInstallation checks every file listed in root's checksum manifest,
+// so a hardened install is only launched once its contents are known good
+func verifyInstallation(root string) error {
+	found, err := verifyManifestFiles(root)
+	if !found {
+		warnf("No %s in %s, launching without content verification", checksumManifestName, root)
+	}
+	return err
+}
@@ -0,0 +1,179 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	// defaultHealthCheckTimeout applies when neither --health-check-timeout nor --timeout is set
+	defaultHealthCheckTimeout = 30 * time.Second
+	// healthCheckInterval is the pause between health check probes
+	healthCheckInterval = time.Second
+	// healthProbeTimeout bounds a single health check request
+	healthProbeTimeout = 5 * time.Second
+)
+
+// healthCheckTimeout returns how long the relaunched app has to become healthy
+func healthCheckTimeout(config *UpdateConfig) time.Duration {
+	if config.HealthCheckTimeout > 0 {
+		return time.Duration(config.HealthCheckTimeout) * time.Second
+	}
+	if config.Timeout > 0 {
+		return time.Duration(config.Timeout) * time.Second
+	}
+	return defaultHealthCheckTimeout
+}
+
+// waitForHealthy polls url with GET until it answers 200 OK or timeout expires
+func waitForHealthy(url string, timeout time.Duration) error {
+	client := &http.Client{Timeout: healthProbeTimeout}
+	deadline := time.Now().Add(timeout)
+
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		lastErr = probeHealth(client, url)
+		if lastErr == nil {
+			infof("Health check attempt %d: %s is healthy", attempt, url)
+			return nil
+		}
+		infof("Health check attempt %d: %v", attempt, lastErr)
+
+		if time.Now().Add(healthCheckInterval).After(deadline) {
+			break
+		}
+		time.Sleep(healthCheckInterval)
+	}
+	return fmt.Errorf("no healthy response from %s within %v: %v", url, timeout, lastErr)
+}
+
+// probeHealth performs a single health check request
+func probeHealth(client *http.Client, url string) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// verifyLaunch checks that the relaunched app is still running after period
+func verifyLaunch(config *UpdateConfig, pid int, period time.Duration) error {
+	exited, err := watchLaunchedProcess(config, pid)
+	if err != nil {
+		return err
+	}
+	if exited == nil {
+		warnf("Cannot watch process %d, skipping --launch-verify-seconds", pid)
+		return nil
+	}
+
+	infof("Verifying that process %d stays up for %v", pid, period)
+	select {
+	case status := <-exited:
+		return fmt.Errorf("process %d exited during startup (%s)", pid, status)
+	case <-time.After(period):
+		infof("Process %d is still running after %v", pid, period)
+		return nil
+	}
+}
+
+// watchLaunchedProcess returns a channel that receives the exit status of the
+// relaunched app pid once it exits, or nil when pid cannot be watched. The app of
+// an .app bundle is started by Launch Services, not as our child, so process.Wait
+// cannot wait on it and it is polled with isProcessAlive instead.
+func watchLaunchedProcess(config *UpdateConfig, pid int) (<-chan string, error) {
+	if pid <= 0 {
+		return nil, nil
+	}
+	appType, err := DetectApplicationType(config.CurrentPath)
+	if err != nil || (appType != MacAppBundle && appType != MacAppBundleDirectory) {
+		return watchProcessExit(pid)
+	}
+	if !isProcessAlive(pid) {
+		// The app's PID was not found and pid is the 'open' helper's, which has exited
+		return nil, nil
+	}
+	return pollProcessExit(pid), nil
+}
+
+// pollProcessExit returns a channel that receives a status once pid, a process
+// that is not our child, is no longer running
+func pollProcessExit(pid int) <-chan string {
+	exited := make(chan string, 1)
+	go func() {
+		for isProcessAlive(pid) {
+			time.Sleep(processPollInterval)
+		}
+		exited <- "no longer running"
+	}()
+	return exited
+}
+
+// watchProcessExit returns a channel that receives the exit status of pid once
+// it exits. Waiting also reaps our child, so a crashed app is not mistaken for a
+// live zombie.
+func watchProcessExit(pid int) (<-chan string, error) {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return nil, fmt.Errorf("cannot watch process %d: %v", pid, err)
+	}
+
+	exited := make(chan string, 1)
+	go func() {
+		state, err := process.Wait()
+		if err != nil {
+			exited <- err.Error()
+			return
+		}
+		exited <- state.String()
+	}()
+	return exited, nil
+}
+
+// rollbackUnhealthyUpdate stops the relaunched app, restores the previous version
+// from backup and launches it again unless --no-launch is set
+func rollbackUnhealthyUpdate(config *UpdateConfig, backup *installBackup, newPID int) error {
+	if newPID > 0 && isProcessAlive(newPID) {
+		infof("Stopping unhealthy process %d", newPID)
+		if err := killProcess(newPID); err != nil {
+			warnf("%v", err)
+		} else {
+			pollForProcessExit(context.Background(), newPID, defaultShutdownTimeout)
+		}
+	}
+
+	// Hardened files can't be removed until the hardening is reverted
+	if err := unhardenInstallation(config.CurrentPath); err != nil {
+		return fmt.Errorf("failed to revert hardening: %w", err)
+	}
+
+	infof("Restoring previous version from %s", backup.dir)
+	if err := backup.rollback(); err != nil {
+		return fmt.Errorf("%w, backup kept at %s: %w", ErrRollbackFailed, backup.dir, err)
+	}
+	runSummary.recordRollback()
+
+	if config.NoLaunch {
+		return nil
+	}
+	pid, err := launchApplication(config.CurrentPath, config.AppName)
+	if err != nil {
+		warnf("Failed to relaunch previous version: %v", err)
+		return nil
+	}
+	runSummary.update(func(sum *updateSummary) { sum.LaunchedPID = pid })
+	if config.PIDFile != "" {
+		if err := writePIDFile(config.PIDFile, pid); err != nil {
+			warnf("%v", err)
+		}
+	}
+	return nil
+}
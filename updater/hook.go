@@ -0,0 +1,63 @@
+package updater
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// hookEnv returns the ATOM_UPDATER_* variables a hook command receives. oldPath is
+// where the previous version is kept while the hook runs, "" when there is none.
+func hookEnv(config *UpdateConfig, oldPath, oldVersion, newVersion string) []string {
+	env := []string{
+		"ATOM_UPDATER_CURRENT_PATH=" + config.CurrentPath,
+		"ATOM_UPDATER_NEW_PATH=" + config.NewPath,
+		"ATOM_UPDATER_OLD_PATH=" + oldPath,
+		"ATOM_UPDATER_OLD_VERSION=" + oldVersion,
+		"ATOM_UPDATER_NEW_VERSION=" + newVersion,
+		"ATOM_UPDATER_VERSION=" + Version,
+	}
+	if config.PID > 0 {
+		env = append(env, fmt.Sprintf("ATOM_UPDATER_PID=%d", config.PID))
+	}
+	return env
+}
+
+// hookDir returns the working directory for hooks: the application directory, or
+// the one holding a single-file application
+func hookDir(currentPath string) string {
+	if info, err := os.Stat(currentPath); err == nil && !info.IsDir() {
+		return filepath.Dir(currentPath)
+	}
+	return currentPath
+}
+
+// runHook runs command through the platform shell in dir with env added to the
+// updater's environment, logging everything it prints. A non-zero exit is an error.
+func runHook(ctx context.Context, name, command, dir string, env []string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+
+	infof("Running %s hook: %s", name, command)
+	output, err := cmd.CombinedOutput()
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		infof("[%s hook] %s", name, scanner.Text())
+	}
+	if err != nil {
+		return fmt.Errorf("%s hook failed: %w", name, err)
+	}
+	infof("Finished %s hook", name)
+	return nil
+}
@@ -0,0 +1,133 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// checkAppIdentity compares the identity of the current and new application
+// (CFBundleIdentifier on macOS, product/company version resources on Windows).
+// A mismatch is logged as a warning, or returned as an error when strict is set.
+func checkAppIdentity(currentPath, newPath, appName string, strict bool) error {
+	var mismatches []string
+
+	switch runtime.GOOS {
+	case "darwin":
+		mismatches = compareBundleIdentifiers(currentPath, newPath)
+	case "windows":
+		mismatches = compareExecutableIdentity(currentPath, newPath, appName)
+	default:
+		return nil
+	}
+
+	if len(mismatches) == 0 {
+		return nil
+	}
+
+	for _, mismatch := range mismatches {
+		warnf("Application identity mismatch: %s", mismatch)
+	}
+	if strict {
+		return fmt.Errorf("application identity mismatch: %s", strings.Join(mismatches, "; "))
+	}
+	return nil
+}
+
+// bundleIdentifiers maps each .app bundle in dir to its CFBundleIdentifier.
+// A structured bundle directory (dir/Contents/Info.plist) is recorded under "".
+func bundleIdentifiers(dir string) map[string]string {
+	identifiers := make(map[string]string)
+
+	if id, err := readPlistString(filepath.Join(dir, "Contents", "Info.plist"), "CFBundleIdentifier"); err == nil {
+		identifiers[""] = id
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return identifiers
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasSuffix(entry.Name(), ".app") {
+			continue
+		}
+		plistPath := filepath.Join(dir, entry.Name(), "Contents", "Info.plist")
+		id, err := readPlistString(plistPath, "CFBundleIdentifier")
+		if err != nil {
+			debugf("No bundle identifier for %s: %v", entry.Name(), err)
+			continue
+		}
+		identifiers[entry.Name()] = id
+	}
+
+	return identifiers
+}
+
+// compareBundleIdentifiers describes bundles whose identifier changed between the two
+// directories. Bundles are matched by name, or paired directly when each side has one.
+func compareBundleIdentifiers(currentPath, newPath string) []string {
+	current := bundleIdentifiers(currentPath)
+	updated := bundleIdentifiers(newPath)
+
+	if len(current) == 1 && len(updated) == 1 {
+		for currentName, currentID := range current {
+			for newName, newID := range updated {
+				if currentID != newID {
+					return []string{fmt.Sprintf("%s is %s but %s is %s", bundleLabel(currentName), currentID, bundleLabel(newName), newID)}
+				}
+			}
+		}
+		return nil
+	}
+
+	var mismatches []string
+	for name, currentID := range current {
+		if newID, ok := updated[name]; ok && newID != currentID {
+			mismatches = append(mismatches, fmt.Sprintf("%s changes identifier from %s to %s", bundleLabel(name), currentID, newID))
+		}
+	}
+	return mismatches
+}
+
+// bundleLabel names a bundle from bundleIdentifiers for log messages
+func bundleLabel(name string) string {
+	if name == "" {
+		return "the bundle directory"
+	}
+	return name
+}
+
+// compareExecutableIdentity describes differences in product and company name
+// between the primary executables of the two directories
+func compareExecutableIdentity(currentPath, newPath, appName string) []string {
+	currentExe, err := findExecutableInDirectory(currentPath, appNameCandidates(appName))
+	if err != nil {
+		return nil
+	}
+	newExe, err := findExecutableInDirectory(newPath, appNameCandidates(appName))
+	if err != nil {
+		return nil
+	}
+
+	currentProduct, currentCompany, err := readVersionStrings(currentExe)
+	if err != nil {
+		debugf("No version information for %s: %v", currentExe, err)
+		return nil
+	}
+	newProduct, newCompany, err := readVersionStrings(newExe)
+	if err != nil {
+		debugf("No version information for %s: %v", newExe, err)
+		return nil
+	}
+
+	var mismatches []string
+	if currentProduct != newProduct {
+		mismatches = append(mismatches, fmt.Sprintf("product name changes from %q to %q", currentProduct, newProduct))
+	}
+	if currentCompany != newCompany {
+		mismatches = append(mismatches, fmt.Sprintf("company name changes from %q to %q", currentCompany, newCompany))
+	}
+	return mismatches
+}
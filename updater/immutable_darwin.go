@@ -0,0 +1,28 @@
+package updater
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// ufImmutable is the user immutable flag (chflags uchg), settable by the file owner
+const ufImmutable = 0x2
+
+// setImmutable sets or clears the user immutable flag on paths
+func setImmutable(paths []string, immutable bool) error {
+	for _, path := range paths {
+		var stat syscall.Stat_t
+		if err := syscall.Stat(path, &stat); err != nil {
+			return fmt.Errorf("failed to stat %s: %v", path, err)
+		}
+
+		flags := stat.Flags &^ ufImmutable
+		if immutable {
+			flags |= ufImmutable
+		}
+		if err := syscall.Chflags(path, int(flags)); err != nil {
+			return fmt.Errorf("failed to change flags of %s: %v", path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package updater
+
+import (
+	"fmt"
+	"strings"
+)
+
+// setImmutable sets or clears the immutable attribute on paths with chattr.
+// This needs CAP_LINUX_IMMUTABLE, so it normally only succeeds as root.
+func setImmutable(paths []string, immutable bool) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	flag := "-i"
+	if immutable {
+		flag = "+i"
+	}
+
+	cmd := newHelperCommand("chattr", append([]string{flag, "--"}, paths...)...)
+	defer cmd.done()
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if cmd.expired() {
+			return cmd.timedOut(err)
+		}
+		return fmt.Errorf("chattr %s failed: %v: %s", flag, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
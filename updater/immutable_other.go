@@ -0,0 +1,16 @@
+//go:build !linux && !darwin
+
+package updater
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// setImmutable is unsupported here; hardening falls back to read-only files
+func setImmutable(paths []string, immutable bool) error {
+	if len(paths) == 0 || !immutable {
+		return nil
+	}
+	return fmt.Errorf("immutable files are not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,251 @@
+package updater
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// copySelector decides whether the source file must be copied over the installed one
+type copySelector func(srcPath, dstPath string, srcInfo, dstInfo fs.FileInfo) bool
+
+// isSourceNewer selects files whose source mtime is later than the installed copy
+func isSourceNewer(srcPath, dstPath string, srcInfo, dstInfo fs.FileInfo) bool {
+	return srcInfo.ModTime().After(dstInfo.ModTime())
+}
+
+// isFileChanged selects files whose size or mtime differs from the installed copy
+func isFileChanged(srcPath, dstPath string, srcInfo, dstInfo fs.FileInfo) bool {
+	return srcInfo.Size() != dstInfo.Size() || !srcInfo.ModTime().Equal(dstInfo.ModTime())
+}
+
+// isContentChanged selects files whose SHA256 differs from the installed copy.
+// A file that cannot be hashed counts as changed.
+func isContentChanged(srcPath, dstPath string, srcInfo, dstInfo fs.FileInfo) bool {
+	if srcInfo.Size() != dstInfo.Size() {
+		return true
+	}
+	srcSum, err := fileSHA256(srcPath)
+	if err != nil {
+		return true
+	}
+	dstSum, err := fileSHA256(dstPath)
+	return err != nil || srcSum != dstSum
+}
+
+// fileSHA256 returns the hex SHA256 of the file at path, from --checksum-cache
+// when the file is unchanged since it was last hashed
+func fileSHA256(path string) (string, error) {
+	if hashCache != nil {
+		return hashCache.sha256(path)
+	}
+	return hashFile(path)
+}
+
+// hashFile reads the file at path and returns its hex SHA256
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// extensionFilter returns a filter that selects files by the --include-ext and
+// --exclude-ext lists, or nil when neither list is set
+func extensionFilter(includeExts, excludeExts []string) func(relPath string) bool {
+	if len(includeExts) == 0 && len(excludeExts) == 0 {
+		return nil
+	}
+
+	return func(relPath string) bool {
+		ext := strings.ToLower(filepath.Ext(relPath))
+		if len(includeExts) > 0 && !containsExtension(includeExts, ext) {
+			return false
+		}
+		return !containsExtension(excludeExts, ext)
+	}
+}
+
+// containsExtension reports whether ext is in exts (case-insensitive, leading dot optional)
+func containsExtension(exts []string, ext string) bool {
+	for _, candidate := range exts {
+		candidate = strings.ToLower(candidate)
+		if !strings.HasPrefix(candidate, ".") {
+			candidate = "." + candidate
+		}
+		if candidate == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// incrementalDirectoryReplace applies an incremental or delta plan from
+// planDirectoryReplace: it creates the planned directories and files, overwrites
+// the files marked for replacement and, in delta mode, deletes the files marked for
+// deletion. Every file it overwrites or deletes is first moved into a backup
+// directory so the whole operation can be rolled back; skipped files are left untouched.
+func incrementalDirectoryReplace(ctx context.Context, currentPath, newPath string, config *UpdateConfig, plan *updatePlan) (*installBackup, error) {
+	infof("Starting incremental directory update: %s -> %s", newPath, currentPath)
+
+	backupDir := newBackupDir(currentPath, config)
+	infof("Step 1: Creating backup directory %s", backupDir)
+	if err := createBackupDir(backupDir, config); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %v", err)
+	}
+
+	var createdDirs, createdFiles, backedUp []string
+	copied, skipped, deleted := 0, 0, 0
+	tracker := newCopyTracker(newPath)
+
+	infof("Step 2: Copying changed files")
+	err := func() error {
+		for _, op := range plan.Operations {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			path := filepath.Join(newPath, op.Path)
+			destPath := filepath.Join(currentPath, op.Path)
+
+			switch op.Action {
+			case planMkdir:
+				if err := mkdirMode(destPath, op.srcInfo.Mode()); err != nil {
+					return fmt.Errorf("failed to create directory %s: %v", destPath, err)
+				}
+				createdDirs = append(createdDirs, destPath)
+				continue
+
+			case planSkip:
+				skipped++
+				tracker.advance(path, 1, op.Size)
+				continue
+
+			case planReplace, planDelete:
+				// Back up the file we are about to overwrite or delete
+				backupPath := filepath.Join(backupDir, op.Path)
+				if err := os.MkdirAll(filepath.Dir(backupPath), 0755); err != nil {
+					return fmt.Errorf("failed to create backup directory for %s: %v", op.Path, err)
+				}
+				if err := renameOrCopy(destPath, backupPath); err != nil {
+					return fmt.Errorf("failed to back up %s: %v", destPath, err)
+				}
+				backedUp = append(backedUp, op.Path)
+				if err := injectFailure(phaseBackup); err != nil {
+					return err
+				}
+				if op.Action == planDelete {
+					debugf("Removed %s", op.Path)
+					removeEmptyParents(currentPath, filepath.Dir(destPath))
+					deleted++
+					continue
+				}
+
+			case planCreate:
+				createdFiles = append(createdFiles, destPath)
+
+			default:
+				return fmt.Errorf("unexpected %s operation in incremental plan for %s", op.Action, op.Path)
+			}
+
+			debugf("Updating %s", op.Path)
+			if err := copyFileRetrying(path, destPath); err != nil {
+				return err
+			}
+			if err := injectFailure(phaseCopy); err != nil {
+				return err
+			}
+
+			// Carry the source times over so later timestamp comparisons stay meaningful,
+			// whatever --no-preserve-times says
+			preserveFileTimes(destPath, op.srcInfo)
+
+			copied++
+			tracker.advance(path, 1, op.Size)
+			runSummary.recordCopy(1, op.Size)
+		}
+		return nil
+	}()
+
+	if err == nil {
+		// Step 2b: Verify the installed structure while the backup still exists
+		if verifyErr := verifyRequiredPaths(currentPath, config.RequirePaths); verifyErr != nil {
+			err = fmt.Errorf("installed version failed structure check: %w", verifyErr)
+		} else {
+			err = injectFailure(phaseFinalize)
+		}
+	}
+
+	if err != nil {
+		warnf("Incremental update failed, rolling back: %v", err)
+		if rollbackErr := rollbackIncremental(currentPath, backupDir, createdFiles, createdDirs, backedUp); rollbackErr != nil {
+			errorf("Rollback failed: %v", rollbackErr)
+			err = withRollbackFailure(err, rollbackErr)
+		}
+		return nil, fmt.Errorf("incremental update failed: %w", err)
+	}
+
+	syncDirLogged(currentPath)
+	infof("Incremental directory update completed: %d files updated, %d removed, %d unchanged", copied, deleted, skipped)
+	return &installBackup{
+		dir:     backupDir,
+		partial: true,
+		rollback: func() error {
+			return rollbackIncremental(currentPath, backupDir, createdFiles, createdDirs, backedUp)
+		},
+	}, nil
+}
+
+// rollbackIncremental undoes an incremental update: it removes files and directories
+// that the update created and moves overwritten files back from the backup
+func rollbackIncremental(currentPath, backupDir string, createdFiles, createdDirs, backedUp []string) error {
+	for _, path := range createdFiles {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove new file %s: %v", path, err)
+		}
+	}
+
+	for _, relPath := range backedUp {
+		originalPath := filepath.Join(currentPath, relPath)
+		os.Remove(originalPath) // May hold a partially copied new version
+		// A delta update may have removed the directory along with its last file
+		if err := os.MkdirAll(filepath.Dir(originalPath), 0755); err != nil {
+			return fmt.Errorf("failed to recreate directory for %s: %v", originalPath, err)
+		}
+		if err := renameOrCopy(filepath.Join(backupDir, relPath), originalPath); err != nil {
+			return fmt.Errorf("failed to restore %s: %v", originalPath, err)
+		}
+	}
+
+	// Remove created directories deepest first
+	for i := len(createdDirs) - 1; i >= 0; i-- {
+		if err := os.RemoveAll(createdDirs[i]); err != nil {
+			return fmt.Errorf("failed to remove new directory %s: %v", createdDirs[i], err)
+		}
+	}
+
+	runSummary.recordRollback()
+	return os.RemoveAll(backupDir)
+}
+
+// removeEmptyParents removes dir and its parents up to root as long as they are
+// empty, so a delta update does not leave behind directories the new version dropped
+func removeEmptyParents(root, dir string) {
+	for dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		if err := os.Remove(dir); err != nil {
+			return // Not empty, or not ours to remove
+		}
+		dir = filepath.Dir(dir)
+	}
+}
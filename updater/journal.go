@@ -0,0 +1,291 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// journalSuffix names the journal kept next to the directory being updated
+const journalSuffix = ".atom-updater-journal"
+
+// Journal states, in the order a directory replacement passes through them
+const (
+	journalBackingUp = "backing-up" // moving the current version into the backup
+	journalCopying   = "copying"    // backup complete, copying the new version in
+	journalInstalled = "installed"  // new version in place, backup not yet removed
+	journalRestoring = "restoring"  // new files cleared, moving the backup back
+)
+
+// updateJournal records an in-progress directory replacement so an update that
+// was killed halfway can be finished or undone with --recover. It lives beside
+// the target directory because the target's contents move during the update.
+type updateJournal struct {
+	State      string    `json:"state"`
+	TargetPath string    `json:"target_path"`
+	SourcePath string    `json:"source_path"`
+	BackupDir  string    `json:"backup_dir"`
+	AppBundles bool      `json:"app_bundles,omitempty"` // backup was made with the .app bundle mover
+	Preserve   []string  `json:"preserve,omitempty"`    // --preserve patterns left in place
+	Exclude    []string  `json:"exclude,omitempty"`     // --exclude patterns deleted instead of copied
+	Bundle     string    `json:"bundle,omitempty"`      // --auto-wrap-bundle: the only entry replaced
+	Swap       bool      `json:"swap,omitempty"`        // --swap: the backup is the renamed current directory
+	StagingDir string    `json:"staging_dir,omitempty"` // --swap: where the new version is assembled
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	// --resumable: the files completely copied so far, relative to the target, with
+	// their sizes, and whether they were verified against checksums.txt as they were
+	Resumable bool             `json:"resumable,omitempty"`
+	Checksums bool             `json:"checksums,omitempty"`
+	Copied    map[string]int64 `json:"copied,omitempty"`
+
+	// --resumable: the copy settings a resumed copy must repeat to produce the
+	// same tree as the interrupted one
+	Ignore          []string `json:"ignore,omitempty"`
+	IncludeExt      []string `json:"include_ext,omitempty"`
+	ExcludeExt      []string `json:"exclude_ext,omitempty"`
+	NoPreserveTimes bool     `json:"no_preserve_times,omitempty"`
+
+	path      string
+	mu        sync.Mutex // guards Copied and flushedAt, which concurrent copies update
+	flushedAt time.Time
+}
+
+// journalFlushInterval is how often the files copied by a resumable update are
+// written to the journal. Files copied since the last write are copied again on resume.
+const journalFlushInterval = time.Second
+
+// journalPath returns where the journal for targetPath is kept
+func journalPath(targetPath string) string {
+	targetPath = filepath.Clean(targetPath)
+	return filepath.Join(filepath.Dir(targetPath), "."+filepath.Base(targetPath)+journalSuffix)
+}
+
+// startJournal writes the initial journal for a replacement. Failing to write it
+// only costs crash recovery, so it is logged and the update goes ahead with a nil journal.
+func startJournal(targetPath, sourcePath, backupDir string, appBundles bool, config *UpdateConfig) *updateJournal {
+	j := &updateJournal{
+		State:           journalBackingUp,
+		TargetPath:      targetPath,
+		SourcePath:      sourcePath,
+		BackupDir:       backupDir,
+		AppBundles:      appBundles,
+		Preserve:        preservePatterns,
+		Exclude:         excludePatterns,
+		Bundle:          wrappedBundle,
+		Ignore:          config.Ignore,
+		IncludeExt:      config.IncludeExt,
+		ExcludeExt:      config.ExcludeExt,
+		NoPreserveTimes: config.NoPreserveTimes,
+		path:            journalPath(targetPath),
+	}
+	if err := j.write(); err != nil {
+		warnf("Failed to write update journal, crash recovery unavailable: %v", err)
+		return nil
+	}
+	return j
+}
+
+// advance records that the replacement reached state. A nil journal is a no-op.
+func (j *updateJournal) advance(state string) {
+	if j == nil {
+		return
+	}
+	j.State = state
+	if state != journalCopying {
+		// Copied files only matter while the copy can still be resumed
+		j.Copied = nil
+	}
+	if err := j.write(); err != nil {
+		warnf("Failed to update journal: %v", err)
+	}
+}
+
+// enableResume makes the journal record each file opts copies, so an interrupted
+// copy can be resumed instead of undone. A nil journal is a no-op.
+func (j *updateJournal) enableResume(opts *copyOptions) {
+	if j == nil {
+		return
+	}
+	j.Resumable = true
+	j.Checksums = opts.checksums != nil
+	j.Copied = make(map[string]int64)
+	opts.journal = j
+	if err := j.write(); err != nil {
+		warnf("Failed to update journal: %v", err)
+	}
+}
+
+// recordCopied notes that the file at relPath was copied completely, writing the
+// journal at most once per journalFlushInterval. A nil journal is a no-op.
+func (j *updateJournal) recordCopied(relPath string, size int64) {
+	if j == nil || !j.Resumable {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Copied[relPath] = size
+	if time.Since(j.flushedAt) < journalFlushInterval {
+		return
+	}
+	if err := j.write(); err != nil {
+		warnf("Failed to update journal: %v", err)
+	}
+	j.flushedAt = time.Now()
+}
+
+// remove deletes the journal once the replacement is finished either way.
+// A nil journal is a no-op.
+func (j *updateJournal) remove() {
+	if j == nil {
+		return
+	}
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		warnf("Failed to remove update journal %s: %v", j.path, err)
+	}
+}
+
+// write stores the journal, replacing the previous one in a single rename
+func (j *updateJournal) write() error {
+	j.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode journal: %v", err)
+	}
+
+	tempPath := generateTempFilename(j.path, "tmp")
+	file, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	file.Close()
+
+	if err := os.Rename(tempPath, j.path); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return nil
+}
+
+// restore returns the function that moves this journal's backup back into place
+func (j *updateJournal) restore() func(backupDir, currentPath string) error {
+	if j.AppBundles {
+		return restoreAppBundleDirectoryBackup
+	}
+	return restoreFromBackup
+}
+
+// readJournal loads the journal left for targetPath, or returns nil if there is none
+func readJournal(targetPath string) (*updateJournal, error) {
+	path := journalPath(targetPath)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %v", err)
+	}
+
+	j := &updateJournal{path: path}
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, fmt.Errorf("failed to parse journal %s: %v", path, err)
+	}
+	return j, nil
+}
+
+// runRecover implements `--recover <dir>`: it finishes or undoes a replacement of
+// dir that was interrupted, according to the journal it left behind
+func runRecover(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s --recover <dir>", os.Args[0])
+	}
+
+	targetPath, err := filepath.Abs(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to resolve '%s': %v", args[0], err)
+	}
+
+	j, err := readJournal(targetPath)
+	if err != nil {
+		return err
+	}
+	if j == nil {
+		infof("No interrupted update found for %s", targetPath)
+		return nil
+	}
+
+	infof("Found interrupted update of %s (state %s, last updated %s)",
+		j.TargetPath, j.State, j.UpdatedAt.Format(time.RFC3339))
+
+	if j.Swap {
+		return recoverSwap(j)
+	}
+
+	// Clearing the partial copy must spare the same paths the update did
+	preservePatterns = j.Preserve
+	wrappedBundle = j.Bundle
+
+	if _, err := os.Stat(j.BackupDir); os.IsNotExist(err) {
+		// The backup is gone, so the update got as far as its final cleanup
+		infof("Backup %s no longer exists, nothing to undo", j.BackupDir)
+		j.remove()
+		return nil
+	}
+
+	switch j.State {
+	case journalInstalled:
+		// The new version was completely installed; only the cleanup was missed
+		infof("New version is fully installed, removing backup %s", j.BackupDir)
+		if err := os.RemoveAll(j.BackupDir); err != nil {
+			return fmt.Errorf("failed to remove backup: %v", err)
+		}
+
+	case journalBackingUp, journalRestoring:
+		// Only previous-version files are present: move the rest of them back
+		infof("Moving the previous version back from %s", j.BackupDir)
+		if err := j.restore()(j.BackupDir, j.TargetPath); err != nil {
+			return fmt.Errorf("failed to restore backup: %v", err)
+		}
+		if err := os.RemoveAll(j.BackupDir); err != nil {
+			warnf("failed to remove backup directory %s: %v", j.BackupDir, err)
+		}
+
+	case journalCopying:
+		if j.Resumable {
+			if _, err := os.Stat(j.SourcePath); err == nil {
+				// --resumable: finish the copy rather than undo it
+				if err := recoverResumable(j); err != nil {
+					return err
+				}
+				infof("Recovery of %s completed", j.TargetPath)
+				return nil
+			}
+			warnf("The new version %s is gone, so the copy cannot be resumed", j.SourcePath)
+		}
+		// A partial copy of the new version is mixed in: remove it and restore the backup
+		warnf("Removing the partially copied new version and restoring %s", j.BackupDir)
+		if err := rollbackDirectoryReplace(j.TargetPath, j.BackupDir, j.restore(), j); err != nil {
+			return fmt.Errorf("failed to restore backup: %v", err)
+		}
+
+	default:
+		return fmt.Errorf("journal %s has unknown state '%s'", j.path, j.State)
+	}
+
+	j.remove()
+	infof("Recovery of %s completed", j.TargetPath)
+	return nil
+}
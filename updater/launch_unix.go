@@ -0,0 +1,13 @@
+//go:build !windows
+
+package updater
+
+import (
+	"syscall"
+)
+
+// detachedProcAttr starts the relaunched app in a session of its own, so it
+// neither gets the updater's SIGHUP nor depends on the updater's terminal
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
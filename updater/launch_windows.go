@@ -0,0 +1,20 @@
+//go:build windows
+
+package updater
+
+import (
+	"syscall"
+)
+
+// Windows creation flags (numeric constants to avoid extra deps).
+// https://learn.microsoft.com/en-us/windows/win32/procthread/process-creation-flags
+const (
+	wDetachedProcess  = 0x00000008 // DETACHED_PROCESS
+	wCreateNewProcGrp = 0x00000200 // CREATE_NEW_PROCESS_GROUP
+)
+
+// detachedProcAttr starts the relaunched app without the updater's console and in
+// its own process group, so closing the console or a Ctrl+C does not reach it
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: wDetachedProcess | wCreateNewProcGrp}
+}
@@ -0,0 +1,218 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+)
+
+// executableCandidate is one entry of `list-executables`
+type executableCandidate struct {
+	Path       string `json:"path"` // relative to the listed directory
+	Size       int64  `json:"size"`
+	Mode       string `json:"mode"`
+	Executable bool   `json:"executable"`
+	AppBundle  bool   `json:"app_bundle,omitempty"`
+	Noise      bool   `json:"noise,omitempty"` // skipped unless --app-name picks it
+	MatchesApp bool   `json:"matches_app_name,omitempty"`
+	Launched   bool   `json:"launched,omitempty"`
+}
+
+// executableListing is what `list-executables` found in a directory
+type executableListing struct {
+	Dir          string                `json:"dir"`
+	Type         string                `json:"type"`
+	Candidates   []executableCandidate `json:"candidates"`
+	Launch       string                `json:"launch,omitempty"`
+	LaunchReason string                `json:"launch_reason,omitempty"`
+	LaunchError  string                `json:"launch_error,omitempty"`
+}
+
+// runListExecutables implements `list-executables <dir> [--app-name <name>] [--json]`:
+// it lists the launch candidates an update would search in dir, in search order, and
+// which one it would start and why, to help pick --app-name
+func runListExecutables(args []string) error {
+	var dir, appName string
+	asJSON := false
+
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--json":
+			asJSON = true
+		case arg == "--app-name":
+			var err error
+			if appName, err = flagValue(args, &i); err != nil {
+				return err
+			}
+		case strings.HasPrefix(arg, "--"):
+			return fmt.Errorf("unknown option '%s' for list-executables", arg)
+		case dir == "":
+			dir = arg
+		default:
+			return fmt.Errorf("list-executables takes a single directory")
+		}
+	}
+
+	if dir == "" {
+		return fmt.Errorf("usage: %s list-executables <dir> [--app-name <name>] [--json]", os.Args[0])
+	}
+
+	listing, err := listExecutables(dir, appName)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		data, err := json.MarshalIndent(listing, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Printf("Directory: %s (%s)\n", listing.Dir, listing.Type)
+	if len(listing.Candidates) == 0 {
+		fmt.Printf("No executables found\n")
+	} else {
+		table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(table, "\tPATH\tSIZE\tMODE\tEXECUTABLE\tNOTE\n")
+		for _, candidate := range listing.Candidates {
+			marker := ""
+			if candidate.Launched {
+				marker = "*"
+			}
+			var notes []string
+			if candidate.MatchesApp {
+				notes = append(notes, "matches --app-name")
+			}
+			if candidate.Noise {
+				notes = append(notes, "looks like a helper, skipped by default")
+			}
+			fmt.Fprintf(table, "%s\t%s\t%d\t%s\t%t\t%s\n", marker, candidate.Path, candidate.Size, candidate.Mode, candidate.Executable, strings.Join(notes, ", "))
+		}
+		table.Flush()
+	}
+	if listing.LaunchError != "" {
+		fmt.Printf("Launch: none (%s)\n", listing.LaunchError)
+	} else {
+		fmt.Printf("Launch: %s (%s)\n", listing.Launch, listing.LaunchReason)
+	}
+	return nil
+}
+
+// listExecutables collects the launch candidates in dir the way an update finds
+// them and works out which one launchApplication would start
+func listExecutables(dir, appName string) (*executableListing, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve path '%s': %v", dir, err)
+	}
+	if info, err := os.Stat(absDir); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory (use detect for a single file)", absDir)
+	}
+
+	appType, err := DetectApplicationType(absDir)
+	if err != nil {
+		return nil, err
+	}
+	listing := &executableListing{Dir: absDir, Type: typeToString(appType), Candidates: []executableCandidate{}}
+
+	extension := ""
+	if runtime.GOOS == "windows" {
+		extension = ".exe"
+	}
+	executables, err := findExecutablesInDirectory(absDir, extension)
+	if err != nil {
+		return nil, err
+	}
+
+	appNames := appNameCandidates(appName)
+	for _, relPath := range executables {
+		info, err := os.Stat(filepath.Join(absDir, relPath))
+		if err != nil {
+			continue
+		}
+		candidate := executableCandidate{
+			Path:       filepath.ToSlash(relPath),
+			Size:       info.Size(),
+			Mode:       info.Mode().String(),
+			Executable: isExecutable(info),
+			Noise:      isNoiseExecutable(relPath),
+			MatchesApp: len(appNames) > 0 && matchesAppName(relPath, appNames),
+		}
+		if info.IsDir() {
+			// A .app bundle is opened rather than executed
+			candidate.AppBundle = true
+			candidate.Executable = true
+			_, candidate.Size, _ = measureTree(filepath.Join(absDir, relPath))
+		}
+		listing.Candidates = append(listing.Candidates, candidate)
+	}
+
+	launch, reason, err := launchChoice(absDir, appType, appNames, executables)
+	if err != nil {
+		listing.LaunchError = err.Error()
+		return listing, nil
+	}
+	listing.Launch = launch
+	listing.LaunchReason = reason
+	for i := range listing.Candidates {
+		if filepath.Join(absDir, listing.Candidates[i].Path) == filepath.Clean(launch) {
+			listing.Candidates[i].Launched = true
+		}
+	}
+	return listing, nil
+}
+
+// launchChoice returns what launchApplication would start in dir, and why
+func launchChoice(dir string, appType ApplicationType, appNames, executables []string) (string, string, error) {
+	switch appType {
+	case MacAppBundleDirectory:
+		for _, exe := range executables {
+			if filepath.Dir(exe) == "." && strings.HasSuffix(exe, ".app") && (len(appNames) == 0 || matchesAppName(exe, appNames)) {
+				if len(appNames) > 0 {
+					return filepath.Join(dir, exe), "the first .app bundle matching --app-name, opened with open", nil
+				}
+				return filepath.Join(dir, exe), "the first .app bundle, opened with open", nil
+			}
+		}
+		return "", "", fmt.Errorf("no .app bundle found in directory: %s", dir)
+
+	case LinuxAppDirectory:
+		if entry := findDesktopEntry(dir, appNames); entry != nil {
+			return strings.Join(entry.args, " "), "Exec line of " + entry.path, nil
+		}
+	}
+
+	launch, err := findExecutableInDirectory(dir, appNames)
+	if err != nil {
+		return "", "", err
+	}
+	relPath, _ := filepath.Rel(dir, launch)
+	switch {
+	case len(appNames) > 0 && matchesAppName(launch, appNames):
+		return launch, "matches --app-name", nil
+	case appType == MacDirectory && isBundleExecutable(dir, launch):
+		return launch, "CFBundleExecutable of Info.plist", nil
+	case len(appNames) > 0:
+		return launch, "nothing matches --app-name, so the first candidate is used", nil
+	case len(executables) > 0 && executables[0] != relPath:
+		return launch, "the first candidate that does not look like a helper", nil
+	default:
+		return launch, "the first candidate", nil
+	}
+}
+
+// isBundleExecutable reports whether exe is the CFBundleExecutable of the
+// bundle-structured directory dir
+func isBundleExecutable(dir, exe string) bool {
+	bundleExe, err := bundleExecutable(dir)
+	return err == nil && filepath.Clean(bundleExe) == filepath.Clean(exe)
+}
@@ -0,0 +1,166 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"time"
+)
+
+// logLevel is the severity of a log entry
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarning
+	levelError
+)
+
+// levelNames are the level names used in JSON entries
+var levelNames = map[logLevel]string{
+	levelDebug:   "debug",
+	levelInfo:    "info",
+	levelWarning: "warning",
+	levelError:   "error",
+}
+
+// minLogLevel is the least severe level that is written, set by --log-level
+var minLogLevel = levelInfo
+
+// parseLogLevel maps a --log-level name to its level
+func parseLogLevel(name string) (logLevel, bool) {
+	switch name {
+	case "debug":
+		return levelDebug, true
+	case "info":
+		return levelInfo, true
+	case "warn", "warning":
+		return levelWarning, true
+	case "error":
+		return levelError, true
+	}
+	return levelInfo, false
+}
+
+// setLogLevel sets the least severe level that is written. Without --log-level,
+// --verbose still means debug.
+func setLogLevel(name string, verbose bool) {
+	minLogLevel = levelInfo
+	if verbose {
+		minLogLevel = levelDebug
+	}
+	if level, ok := parseLogLevel(name); ok {
+		minLogLevel = level
+	}
+	verboseLogging = minLogLevel == levelDebug
+}
+
+// Log formats accepted by --log-format
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// logFormat is the active log format
+var logFormat = logFormatText
+
+// logEntry is one line of JSON log output
+type logEntry struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+	Step    string `json:"step,omitempty"`
+	Source  string `json:"source,omitempty"`
+}
+
+// stepPattern picks the step number out of "Step 2b: ..." messages
+var stepPattern = regexp.MustCompile(`^Step (\w+): `)
+
+// errorConsole writes errors to stderr under --quiet, when the standard logger
+// only writes to the log file. It is nil otherwise.
+var errorConsole *log.Logger
+
+// setLogFormat switches between text and JSON log output. JSON entries carry
+// their own timestamp and source, so the standard log prefix is turned off.
+func setLogFormat(format string) {
+	if format != logFormatJSON {
+		return
+	}
+	logFormat = logFormatJSON
+	log.SetFlags(0)
+	if errorConsole != nil {
+		errorConsole.SetFlags(0)
+	}
+}
+
+// output writes a formatted entry to the log, and to the console under --quiet
+// when it is an error. calldepth counts from the caller of logAt.
+func output(level logLevel, calldepth int, s string) {
+	log.Output(calldepth+1, s)
+	if errorConsole != nil && level >= levelError {
+		errorConsole.Output(calldepth+1, s)
+	}
+}
+
+// logAt writes message at level. In text mode prefix is put in front of it,
+// which keeps the text log looking as it always has ("Warning: ...").
+func logAt(level logLevel, prefix, message string) {
+	if level < minLogLevel {
+		return
+	}
+
+	if logFormat != logFormatJSON {
+		output(level, 3, prefix+message)
+		return
+	}
+
+	entry := logEntry{
+		Time:    time.Now().UTC().Format(time.RFC3339Nano),
+		Level:   levelNames[level],
+		Message: message,
+	}
+	if match := stepPattern.FindStringSubmatch(message); match != nil {
+		entry.Step = match[1]
+	}
+	if _, file, line, ok := runtime.Caller(2); ok {
+		entry.Source = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		output(level, 3, prefix+message)
+		return
+	}
+	output(level, 3, string(data))
+}
+
+// debugf logs a per-file detail, written only at --log-level debug
+func debugf(format string, args ...interface{}) {
+	logAt(levelDebug, "[debug] ", fmt.Sprintf(format, args...))
+}
+
+// infof logs a progress message
+func infof(format string, args ...interface{}) {
+	logAt(levelInfo, "", fmt.Sprintf(format, args...))
+}
+
+// warnf logs a problem the update carries on after
+func warnf(format string, args ...interface{}) {
+	logAt(levelWarning, "Warning: ", fmt.Sprintf(format, args...))
+}
+
+// errorf logs a failure that needs attention, such as a rollback that did not complete
+func errorf(format string, args ...interface{}) {
+	logAt(levelError, "CRITICAL: ", fmt.Sprintf(format, args...))
+}
+
+// exitf logs a failure and exits with code, one of the documented exit codes
+func exitf(code int, format string, args ...interface{}) {
+	logAt(levelError, "", fmt.Sprintf(format, args...))
+	os.Exit(code)
+}
@@ -0,0 +1,76 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// versionFileName is the file inside an app directory that holds its version string
+const versionFileName = "version.txt"
+
+// appVersionFile is the version file read from app directories, relative to them
+// (--version-file, default versionFileName)
+var appVersionFile = versionFileName
+
+// UpdateMarker is written after a successful update so the relaunched app knows
+// it was just updated (to show release notes, run migrations, ...). The app is
+// expected to delete the marker once it has acted on it.
+type UpdateMarker struct {
+	OldVersion     string    `json:"old_version,omitempty"`
+	NewVersion     string    `json:"new_version,omitempty"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	AppPath        string    `json:"app_path"`
+	UpdaterVersion string    `json:"updater_version"`
+}
+
+// readAppVersion returns the version recorded in dir, or "" if there is none
+func readAppVersion(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, appVersionFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// writeUpdateMarker writes marker as JSON to markerPath. Relative paths are
+// resolved against the app directory.
+func writeUpdateMarker(markerPath string, marker UpdateMarker) error {
+	if !filepath.IsAbs(markerPath) {
+		markerPath = filepath.Join(marker.AppPath, markerPath)
+	}
+
+	data, err := json.MarshalIndent(marker, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode update marker: %v", err)
+	}
+
+	// Write to a temp file first so the app never reads a half-written marker
+	tempPath := generateTempFilename(markerPath, "tmp")
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write update marker: %v", err)
+	}
+	if err := os.Rename(tempPath, markerPath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to move update marker into place: %v", err)
+	}
+	return nil
+}
+
+// writePIDFile records the PID of the launched application at pidPath, replacing
+// the file atomically so a parent polling it never reads a partial number
+func writePIDFile(pidPath string, pid int) error {
+	tempPath := generateTempFilename(pidPath, "tmp")
+	if err := os.WriteFile(tempPath, []byte(fmt.Sprintf("%d\n", pid)), 0644); err != nil {
+		return fmt.Errorf("failed to write PID file: %v", err)
+	}
+	if err := os.Rename(tempPath, pidPath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to move PID file into place: %v", err)
+	}
+	infof("Wrote PID %d to %s", pid, pidPath)
+	return nil
+}
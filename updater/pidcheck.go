@@ -0,0 +1,42 @@
+package updater
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// checkPIDOwnsPath confirms that the process the update waits for runs an executable
+// inside currentPath, so a wrong PID does not get an unrelated application stopped
+// and its directory replaced. A mismatch is a warning, or an error with --strict-pid-check.
+func checkPIDOwnsPath(pid int, currentPath string, strict bool) error {
+	if !isProcessAlive(pid) {
+		infof("Process %d is not running, nothing to check against %s", pid, currentPath)
+		return nil
+	}
+
+	report := func(format string, args ...interface{}) error {
+		if strict {
+			return fmt.Errorf(format+" (--strict-pid-check)", args...)
+		}
+		warnf(format, args...)
+		return nil
+	}
+
+	exe, err := processExecutable(pid)
+	if err != nil {
+		return report("cannot tell which executable process %d runs: %v", pid, err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	root := currentPath
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+
+	if !isPathWithin(exe, root) {
+		return report("process %d runs %s, which is not inside %s: is it the right PID?", pid, exe, currentPath)
+	}
+	infof("Process %d runs %s from %s", pid, exe, currentPath)
+	return nil
+}
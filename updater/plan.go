@@ -0,0 +1,210 @@
+package updater
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// planAction is what an update does to a single path
+type planAction string
+
+const (
+	planMkdir   planAction = "mkdir"   // directory missing from the current version
+	planCreate  planAction = "create"  // file missing from the current version
+	planReplace planAction = "replace" // file overwritten with the new version
+	planDelete  planAction = "delete"  // file absent from the new version
+	planSkip    planAction = "skip"    // file excluded, preserved or unchanged, left as is
+)
+
+// planOperation is one step of an update plan
+type planOperation struct {
+	Action planAction `json:"action"`
+	Path   string     `json:"path"` // relative to the application directory
+	Size   int64      `json:"size,omitempty"`
+
+	srcInfo fs.FileInfo // source file, for operations that copy
+}
+
+// updatePlan lists everything an update will do to the current directory
+type updatePlan struct {
+	Mode       string          `json:"mode"` // "full", "incremental" or "delta"
+	Operations []planOperation `json:"operations"`
+}
+
+// incrementalSelectors returns the file selectors for a targeted update, or ok=false
+// when config asks for a full replacement
+func incrementalSelectors(config *UpdateConfig) (include func(relPath string) bool, needsCopy copySelector, ok bool) {
+	include = extensionFilter(config.IncludeExt, config.ExcludeExt)
+	switch {
+	case config.Delta && (config.VerifyChecksum || config.Checksum != ""):
+		needsCopy = isContentChanged
+	case config.Delta:
+		needsCopy = isFileChanged
+	case config.NewerOnly:
+		needsCopy = isSourceNewer
+	}
+	return include, needsCopy, needsCopy != nil || include != nil
+}
+
+// planDirectoryReplace works out what replacing currentPath with newPath would do,
+// without changing anything
+func planDirectoryReplace(currentPath, newPath string, config *UpdateConfig) (*updatePlan, error) {
+	currentType, err := DetectApplicationType(currentPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect current app type: %w", err)
+	}
+
+	include, needsCopy, incremental := incrementalSelectors(config)
+	if currentType == MacAppBundleDirectory {
+		// .app bundles are always replaced as a whole
+		include, needsCopy, incremental = nil, nil, false
+	}
+
+	plan := &updatePlan{Mode: "full"}
+	switch {
+	case incremental && config.Delta:
+		plan.Mode = "delta"
+	case incremental:
+		plan.Mode = "incremental"
+	}
+
+	inNewVersion := make(map[string]bool)
+	err = filepath.WalkDir(newPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(newPath, path)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			return nil
+		}
+		if isExcludedRel(relPath) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil // Not installed
+		}
+		inNewVersion[relPath] = true
+		destPath := filepath.Join(currentPath, relPath)
+
+		if isPreservedRel(relPath) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			plan.add(planSkip, relPath, info)
+			return nil
+		}
+
+		if d.IsDir() {
+			if _, err := os.Lstat(destPath); os.IsNotExist(err) {
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				plan.add(planMkdir, relPath, info)
+			}
+			return nil
+		}
+
+		srcInfo, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if include != nil && !include(relPath) {
+			plan.add(planSkip, relPath, srcInfo)
+			return nil
+		}
+
+		dstInfo, err := os.Lstat(destPath)
+		switch {
+		case os.IsNotExist(err):
+			plan.add(planCreate, relPath, srcInfo)
+		case err != nil:
+			return fmt.Errorf("failed to stat %s: %v", destPath, err)
+		case needsCopy != nil && !needsCopy(path, destPath, srcInfo, dstInfo):
+			plan.add(planSkip, relPath, srcInfo)
+		default:
+			plan.add(planReplace, relPath, srcInfo)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A full or delta replacement removes whatever the new version no longer ships
+	if plan.Mode != "incremental" {
+		err = filepath.WalkDir(currentPath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			relPath, err := filepath.Rel(currentPath, path)
+			if err != nil {
+				return err
+			}
+			if relPath != "." && d.IsDir() && (isPreservedRel(relPath) || isUpdaterArtifact(d.Name())) {
+				return filepath.SkipDir
+			}
+			if relPath == "." || d.IsDir() || inNewVersion[relPath] || isPreservedRel(relPath) {
+				return nil
+			}
+			if include != nil && !include(relPath) {
+				return nil // Outside the files this update manages
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			plan.add(planDelete, relPath, info)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return plan, nil
+}
+
+// add appends an operation for relPath to the plan
+func (p *updatePlan) add(action planAction, relPath string, info fs.FileInfo) {
+	op := planOperation{Action: action, Path: relPath, srcInfo: info}
+	if info != nil && info.Mode().IsRegular() {
+		op.Size = info.Size()
+	}
+	p.Operations = append(p.Operations, op)
+}
+
+// count returns how many operations of the given kind the plan holds
+func (p *updatePlan) count(action planAction) int {
+	n := 0
+	for _, op := range p.Operations {
+		if op.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// logPlan writes a summary of the plan to the log, preceded by every operation when detailed
+func logPlan(plan *updatePlan, detailed bool) {
+	infof("Update plan (%s replacement):", plan.Mode)
+	if detailed {
+		for _, op := range plan.Operations {
+			infof("  %-8s %s", op.Action, op.Path)
+		}
+	}
+	infof("Summary: %d to create, %d to replace, %d to delete, %d unchanged, %d new directories",
+		plan.count(planCreate), plan.count(planReplace), plan.count(planDelete), plan.count(planSkip), plan.count(planMkdir))
+}
@@ -0,0 +1,59 @@
+package updater
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// readPlistString returns the string value stored under key in an XML property list.
+// Binary property lists are not supported.
+func readPlistString(plistPath, key string) (string, error) {
+	data, err := os.ReadFile(plistPath)
+	if err != nil {
+		return "", err
+	}
+
+	if bytes.HasPrefix(data, []byte("bplist")) {
+		return "", fmt.Errorf("%s is a binary property list", plistPath)
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	lastKey := ""
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse %s: %v", plistPath, err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "key":
+			if err := decoder.DecodeElement(&lastKey, &start); err != nil {
+				return "", fmt.Errorf("failed to parse %s: %v", plistPath, err)
+			}
+			continue
+		case "string":
+			if lastKey == key {
+				var value string
+				if err := decoder.DecodeElement(&value, &start); err != nil {
+					return "", fmt.Errorf("failed to parse %s: %v", plistPath, err)
+				}
+				return strings.TrimSpace(value), nil
+			}
+		}
+		lastKey = ""
+	}
+
+	return "", fmt.Errorf("key %s not found in %s", key, plistPath)
+}
@@ -0,0 +1,132 @@
+package updater
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// preservePatterns are the --preserve globs. Paths matching them, relative to the
+// application directory, are neither moved to the backup nor overwritten, so user
+// data kept inside the install survives the update. The current, new and backup
+// trees share one layout, so the same patterns apply relative to any of their roots.
+var preservePatterns []string
+
+// excludePatterns are the --exclude globs, for regenerable data such as caches.
+// Matching paths under the current directory are deleted instead of being moved
+// to the backup, and matching paths in the new version are not copied.
+var excludePatterns []string
+
+// wrappedBundle is the name of the .app bundle given directly as current_dir or
+// new_dir with --auto-wrap-bundle. The update then runs on the directories holding
+// it and every other entry in them is left alone as if preserved.
+var wrappedBundle string
+
+// preserving reports whether an update leaves any paths in place
+func preserving() bool {
+	return len(preservePatterns) > 0 || wrappedBundle != ""
+}
+
+// matchesPathOrParent reports whether relPath, or a directory containing it,
+// matches one of patterns
+func matchesPathOrParent(relPath string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+
+	slashPath := filepath.ToSlash(relPath)
+	for {
+		if matchesAnyPattern(slashPath, patterns) {
+			return true
+		}
+		i := strings.LastIndex(slashPath, "/")
+		if i < 0 {
+			return false
+		}
+		slashPath = slashPath[:i]
+	}
+}
+
+// isPreservedRel reports whether relPath, or a directory containing it, matches
+// one of the preserve patterns
+func isPreservedRel(relPath string) bool {
+	if wrappedBundle != "" {
+		if top, _, _ := strings.Cut(filepath.ToSlash(relPath), "/"); top != wrappedBundle {
+			return true
+		}
+	}
+	return matchesPathOrParent(relPath, preservePatterns)
+}
+
+// isExcludedRel reports whether relPath, or a directory containing it, matches
+// one of the exclude patterns. Preserved paths are never excluded.
+func isExcludedRel(relPath string) bool {
+	return matchesPathOrParent(relPath, excludePatterns) && !isPreservedRel(relPath)
+}
+
+// isPreserved reports whether path, which lies under root, is preserved
+func isPreserved(root, path string) bool {
+	if !preserving() {
+		return false
+	}
+	relPath, err := filepath.Rel(root, path)
+	if err != nil || relPath == "." || strings.HasPrefix(relPath, "..") {
+		return false
+	}
+	return isPreservedRel(relPath)
+}
+
+// isExcluded reports whether path, which lies under root, is excluded
+func isExcluded(root, path string) bool {
+	if len(excludePatterns) == 0 {
+		return false
+	}
+	relPath, err := filepath.Rel(root, path)
+	if err != nil || relPath == "." || strings.HasPrefix(relPath, "..") {
+		return false
+	}
+	return isExcludedRel(relPath)
+}
+
+// discardExcluded deletes an excluded path instead of moving it to the backup.
+// Excluded data is regenerable, so it is not worth the time or the disk space.
+func discardExcluded(path string) error {
+	debugf("Discarding excluded %s", path)
+	if err := removeAllRetrying(path); err != nil {
+		return fmt.Errorf("failed to delete excluded %s: %v", path, err)
+	}
+	return nil
+}
+
+// measureReplaceable is measureTree without the preserved paths under root,
+// which an update leaves where they are, and the excluded ones, which it deletes
+func measureReplaceable(root string) (files int, bytes int64, err error) {
+	if !preserving() && len(excludePatterns) == 0 {
+		return measureTree(root)
+	}
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if isPreserved(root, path) || isExcluded(root, path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files++
+		bytes += info.Size()
+		return nil
+	})
+	return files, bytes, err
+}
@@ -0,0 +1,27 @@
+//go:build !windows
+
+package updater
+
+import (
+	"context"
+	"syscall"
+	"time"
+)
+
+// isProcessAlive reports whether a process with the given PID exists.
+// Signal 0 performs the existence and permission checks without delivering anything.
+func isProcessAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+
+	err := syscall.Kill(pid, 0)
+	// EPERM means the process exists but belongs to another user
+	return err == nil || err == syscall.EPERM
+}
+
+// waitForProcessHandle is unavailable here: a process we did not start cannot
+// be waited on, so callers always poll
+func waitForProcessHandle(ctx context.Context, pid int, timeout time.Duration) (exited, ok bool) {
+	return false, false
+}
@@ -0,0 +1,53 @@
+package updater
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// helperProcessEnv makes the test binary act as a child that runs until its
+// standard input is closed
+const helperProcessEnv = "ATOM_UPDATER_TEST_HELPER_PROCESS"
+
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv(helperProcessEnv) != "1" {
+		return
+	}
+	io.Copy(io.Discard, os.Stdin)
+	os.Exit(0)
+}
+
+func TestIsProcessAlive(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	cmd.Env = append(os.Environ(), helperProcessEnv+"=1")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	pid := cmd.Process.Pid
+
+	if !isProcessAlive(pid) {
+		t.Errorf("isProcessAlive(%d) = false while the child runs", pid)
+	}
+
+	stdin.Close()
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("child failed: %v", err)
+	}
+	if isProcessAlive(pid) {
+		t.Errorf("isProcessAlive(%d) = true after the child exited", pid)
+	}
+}
+
+func TestIsProcessAliveInvalidPID(t *testing.T) {
+	for _, pid := range []int{0, -1} {
+		if isProcessAlive(pid) {
+			t.Errorf("isProcessAlive(%d) = true", pid)
+		}
+	}
+}
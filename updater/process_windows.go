@@ -0,0 +1,81 @@
+//go:build windows
+
+package updater
+
+import (
+	"context"
+	"syscall"
+	"time"
+)
+
+const (
+	processQueryLimitedInformation = 0x1000 // PROCESS_QUERY_LIMITED_INFORMATION
+	stillActive                    = 259    // STILL_ACTIVE exit code
+)
+
+// isProcessAlive reports whether a process with the given PID is still running
+func isProcessAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		// Access denied means the process exists but we may not query it
+		return err == syscall.ERROR_ACCESS_DENIED
+	}
+	defer syscall.CloseHandle(handle)
+
+	var exitCode uint32
+	if err := syscall.GetExitCodeProcess(handle, &exitCode); err != nil {
+		return false
+	}
+	return exitCode == stillActive
+}
+
+// waitForProcessHandle blocks on the process handle until pid exits, timeout
+// passes (0 waits forever) or ctx is cancelled. Unlike polling, the handle pins the
+// process, so a PID reused by another program cannot be mistaken for the old app.
+// ok is false when the handle cannot be opened with SYNCHRONIZE access and the
+// caller must poll.
+func waitForProcessHandle(ctx context.Context, pid int, timeout time.Duration) (exited, ok bool) {
+	handle, err := syscall.OpenProcess(syscall.SYNCHRONIZE|processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		debugf("Cannot open process %d for waiting, polling instead: %v", pid, err)
+		return false, false
+	}
+	defer syscall.CloseHandle(handle)
+
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+
+	// Wait in slices so a cancelled ctx is noticed while the process runs on
+	for {
+		slice := processPollInterval
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return false, true
+			}
+			if remaining < slice {
+				slice = remaining
+			}
+		}
+
+		event, err := syscall.WaitForSingleObject(handle, uint32(slice.Milliseconds()))
+		switch {
+		case err != nil:
+			debugf("Waiting on process %d failed, polling instead: %v", pid, err)
+			return false, false
+		case event == syscall.WAIT_OBJECT_0:
+			return true, true
+		case event != syscall.WAIT_TIMEOUT:
+			return false, false
+		}
+		if ctx.Err() != nil {
+			return false, true
+		}
+	}
+}
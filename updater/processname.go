@@ -0,0 +1,50 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// runningProcess is a process found by listProcesses
+type runningProcess struct {
+	pid       int
+	name      string // executable name without directory
+	truncated bool   // name may be cut short by the OS
+}
+
+// findProcessesByName returns the PIDs of running processes whose executable is
+// named name, excluding the updater itself. On Windows the comparison ignores case
+// and a trailing .exe, so "MyApp" matches MyApp.exe.
+func findProcessesByName(name string) ([]int, error) {
+	processes, err := listProcesses()
+	if err != nil {
+		return nil, err
+	}
+
+	self := os.Getpid()
+	var pids []int
+	for _, p := range processes {
+		if p.pid != self && processNameMatches(p, name) {
+			pids = append(pids, p.pid)
+		}
+	}
+	sort.Ints(pids)
+	return pids, nil
+}
+
+// processNameMatches reports whether the executable of p has the wanted name
+func processNameMatches(p runningProcess, wanted string) bool {
+	processName := filepath.Base(p.name)
+	wanted = filepath.Base(wanted)
+	if runtime.GOOS == "windows" {
+		processName = strings.TrimSuffix(strings.ToLower(processName), ".exe")
+		wanted = strings.TrimSuffix(strings.ToLower(wanted), ".exe")
+	}
+	if p.truncated && len(wanted) > len(processName) {
+		return strings.HasPrefix(wanted, processName)
+	}
+	return processName == wanted
+}
@@ -0,0 +1,53 @@
+//go:build linux
+
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// linuxCommLen is the longest process name /proc/<pid>/comm holds
+const linuxCommLen = 15
+
+// listProcesses lists running processes from /proc. The name comes from the
+// executable link, which is not truncated like comm; processes whose link we may
+// not read, such as those of other users, fall back to comm.
+func listProcesses() ([]runningProcess, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	var processes []runningProcess
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		procDir := filepath.Join("/proc", entry.Name())
+
+		if exe, err := os.Readlink(filepath.Join(procDir, "exe")); err == nil {
+			// A replaced binary shows up as "/path/app (deleted)"
+			exe = strings.TrimSuffix(exe, " (deleted)")
+			processes = append(processes, runningProcess{pid: pid, name: filepath.Base(exe)})
+			continue
+		}
+		if comm, err := os.ReadFile(filepath.Join(procDir, "comm")); err == nil {
+			name := strings.TrimSpace(string(comm))
+			processes = append(processes, runningProcess{pid: pid, name: name, truncated: len(name) == linuxCommLen})
+		}
+	}
+	return processes, nil
+}
+
+// processExecutable returns the path of the executable pid runs, from /proc/<pid>/exe
+func processExecutable(pid int) (string, error) {
+	exe, err := os.Readlink(filepath.Join("/proc", strconv.Itoa(pid), "exe"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(exe, " (deleted)"), nil
+}
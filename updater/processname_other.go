@@ -0,0 +1,55 @@
+//go:build !linux && !windows
+
+package updater
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// listProcesses lists running processes with ps, which reports the full
+// executable path on macOS and the BSDs
+func listProcesses() ([]runningProcess, error) {
+	cmd := newHelperCommand("ps", "-A", "-o", "pid=", "-o", "comm=")
+	defer cmd.done()
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, cmd.timedOut(err)
+	}
+
+	var processes []runningProcess
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.SplitN(strings.TrimSpace(scanner.Text()), " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		name := filepath.Base(strings.TrimSpace(fields[1]))
+		processes = append(processes, runningProcess{pid: pid, name: name})
+	}
+	return processes, scanner.Err()
+}
+
+// processExecutable returns the path of the executable pid runs, as ps reports
+// it (proc_pidpath on macOS needs cgo, which the updater is built without)
+func processExecutable(pid int) (string, error) {
+	cmd := newHelperCommand("ps", "-p", strconv.Itoa(pid), "-o", "comm=")
+	defer cmd.done()
+	output, err := cmd.Output()
+	if err != nil {
+		return "", cmd.timedOut(err)
+	}
+	exe := strings.TrimSpace(string(output))
+	if !filepath.IsAbs(exe) {
+		return "", fmt.Errorf("ps reports no executable path for process %d, only %q", pid, exe)
+	}
+	return exe, nil
+}
@@ -0,0 +1,55 @@
+//go:build windows
+
+package updater
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var procQueryFullProcessImageNameW = kernel32.NewProc("QueryFullProcessImageNameW")
+
+// listProcesses lists running processes from a Toolhelp snapshot
+func listProcesses() ([]runningProcess, error) {
+	snapshot, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.CloseHandle(snapshot)
+
+	var entry syscall.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	if err := syscall.Process32First(snapshot, &entry); err != nil {
+		return nil, err
+	}
+
+	var processes []runningProcess
+	for {
+		processes = append(processes, runningProcess{
+			pid:  int(entry.ProcessID),
+			name: syscall.UTF16ToString(entry.ExeFile[:]),
+		})
+		if err := syscall.Process32Next(snapshot, &entry); err != nil {
+			if err == syscall.ERROR_NO_MORE_FILES {
+				return processes, nil
+			}
+			return nil, err
+		}
+	}
+}
+
+// processExecutable returns the path of the executable pid runs, from QueryFullProcessImageName
+func processExecutable(pid int) (string, error) {
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return "", err
+	}
+	defer syscall.CloseHandle(handle)
+
+	buffer := make([]uint16, syscall.MAX_LONG_PATH)
+	size := uint32(len(buffer))
+	if ret, _, err := procQueryFullProcessImageNameW.Call(uintptr(handle), 0, uintptr(unsafe.Pointer(&buffer[0])), uintptr(unsafe.Pointer(&size))); ret == 0 {
+		return "", err
+	}
+	return syscall.UTF16ToString(buffer[:size]), nil
+}
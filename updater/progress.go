@@ -0,0 +1,182 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// etaWarmup is how long to measure throughput before estimating time remaining
+	etaWarmup = 2 * time.Second
+	// etaWindow is the span of recent samples the throughput average covers
+	etaWindow = 5 * time.Second
+	// progressReportInterval limits how often progress is reported
+	progressReportInterval = time.Second
+)
+
+// progressOutput receives every progress report as a JSON line when
+// --progress-fd or --progress-file is set
+var progressOutput io.Writer
+
+// throughputSample records how many bytes had been processed at a point in time
+type throughputSample struct {
+	at    time.Time
+	bytes int64
+}
+
+// progressTracker accumulates copy progress and reports it with an ETA.
+// It is safe for concurrent use: updates and reports are serialized by mu,
+// so reported counters never go backwards even when files finish out of order.
+type progressTracker struct {
+	mu         sync.Mutex
+	progress   Progress
+	started    time.Time
+	samples    []throughputSample
+	lastReport time.Time
+	report     func(Progress)
+}
+
+// newProgressTracker creates a tracker for a copy of the given size
+func newProgressTracker(totalFiles int, totalBytes int64, report func(Progress)) *progressTracker {
+	now := time.Now()
+	return &progressTracker{
+		progress: Progress{TotalFiles: totalFiles, TotalBytes: totalBytes},
+		started:  now,
+		samples:  []throughputSample{{at: now}},
+		report:   report,
+	}
+}
+
+// advance records that files/bytes under path were copied. A nil tracker is a no-op.
+func (t *progressTracker) advance(path string, files int, bytes int64) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.progress.CurrentFile = path
+	t.progress.Processed += files
+	t.progress.ProcessedBytes += bytes
+
+	// Keep only the samples inside the rolling window
+	t.samples = append(t.samples, throughputSample{at: now, bytes: t.progress.ProcessedBytes})
+	for len(t.samples) > 2 && now.Sub(t.samples[1].at) > etaWindow {
+		t.samples = t.samples[1:]
+	}
+	t.progress.ETASeconds = t.estimateRemaining(now)
+
+	done := t.progress.Processed >= t.progress.TotalFiles
+	if t.report != nil && (done || now.Sub(t.lastReport) >= progressReportInterval) {
+		t.lastReport = now
+		t.report(t.progress)
+	}
+}
+
+// estimateRemaining returns the seconds left at the rolling average throughput,
+// or nil while there isn't enough data for a stable estimate. Callers hold t.mu.
+func (t *progressTracker) estimateRemaining(now time.Time) *int {
+	if now.Sub(t.started) < etaWarmup {
+		return nil
+	}
+
+	oldest := t.samples[0]
+	elapsed := now.Sub(oldest.at).Seconds()
+	copied := t.progress.ProcessedBytes - oldest.bytes
+	if elapsed <= 0 || copied <= 0 {
+		return nil
+	}
+
+	remaining := t.progress.TotalBytes - t.progress.ProcessedBytes
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	eta := int(float64(remaining)/(float64(copied)/elapsed) + 0.5)
+	return &eta
+}
+
+// measureTree counts the regular files under root and their total size
+func measureTree(root string) (files int, bytes int64, err error) {
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files++
+		bytes += info.Size()
+		return nil
+	})
+	return files, bytes, err
+}
+
+// logProgress writes a progress report to the log
+func logProgress(p Progress) {
+	percent := 100.0
+	if p.TotalBytes > 0 {
+		percent = float64(p.ProcessedBytes) * 100 / float64(p.TotalBytes)
+	}
+
+	if p.ETASeconds != nil {
+		infof("Progress: %d/%d files (%.0f%%), about %ds remaining", p.Processed, p.TotalFiles, percent, *p.ETASeconds)
+	} else {
+		infof("Progress: %d/%d files (%.0f%%)", p.Processed, p.TotalFiles, percent)
+	}
+}
+
+// reportProgress logs a progress report and streams it to progressOutput, if set
+func reportProgress(p Progress) {
+	logProgress(p)
+	if progressOutput == nil {
+		return
+	}
+
+	line, err := json.Marshal(p)
+	if err == nil {
+		_, err = progressOutput.Write(append(line, '\n'))
+	}
+	if err != nil {
+		// The reader went away; keep updating without it
+		warnf("Failed to write progress, disabling progress output: %v", err)
+		progressOutput = nil
+	}
+}
+
+// openProgressOutput opens the destination for JSON progress lines: an inherited
+// file descriptor, a file (created or truncated), or nil when neither is configured
+func openProgressOutput(config *UpdateConfig) (*os.File, error) {
+	switch {
+	case config.ProgressFD > 0:
+		file := os.NewFile(uintptr(config.ProgressFD), "progress")
+		if file == nil {
+			return nil, fmt.Errorf("invalid progress file descriptor %d", config.ProgressFD)
+		}
+		if _, err := file.Stat(); err != nil {
+			return nil, fmt.Errorf("progress file descriptor %d is not open: %v", config.ProgressFD, err)
+		}
+		return file, nil
+	case config.ProgressFile != "":
+		file, err := os.Create(config.ProgressFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create progress file: %v", err)
+		}
+		return file, nil
+	default:
+		return nil, nil
+	}
+}
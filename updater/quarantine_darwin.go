@@ -0,0 +1,32 @@
+package updater
+
+import (
+	"fmt"
+	"strings"
+)
+
+// quarantineAttr is the extended attribute Gatekeeper checks on downloaded files
+const quarantineAttr = "com.apple.quarantine"
+
+// clearQuarantine removes the quarantine attribute from everything under path, so
+// Gatekeeper does not block the launch of a freshly installed download. Files
+// without the attribute are not an error.
+func clearQuarantine(path string) error {
+	infof("Clearing %s from %s", quarantineAttr, path)
+	cmd := newHelperCommand("xattr", "-dr", quarantineAttr, path)
+	defer cmd.done()
+	output, err := cmd.CombinedOutput()
+	message := strings.TrimSpace(string(output))
+	if err != nil {
+		if cmd.expired() {
+			return cmd.timedOut(err)
+		}
+		if strings.Contains(message, "No such xattr") {
+			infof("No quarantine attribute present")
+			return nil
+		}
+		return fmt.Errorf("xattr failed: %v: %s", err, message)
+	}
+	infof("Quarantine attribute cleared")
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !darwin
+
+package updater
+
+// clearQuarantine is a no-op: only macOS quarantines downloaded files
+func clearQuarantine(path string) error {
+	debugf("Not clearing quarantine on %s, only macOS sets it", path)
+	return nil
+}
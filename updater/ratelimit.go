@@ -0,0 +1,72 @@
+package updater
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// copyRateLimiter bounds the combined throughput of file copies (--max-copy-rate),
+// or is nil when copies run at full speed
+var copyRateLimiter *rateLimiter
+
+// rateLimiter is a token bucket shared by every copy, so concurrent copies
+// together stay under the rate. Bytes are reserved before they are read and a
+// reader that overdraws the bucket sleeps until it is paid back.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	burst  float64 // most bytes that can be saved up while idle
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter for bytesPerSecond, or nil for 0 (unlimited)
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	// A tenth of a second's worth keeps the pace even without long stalls
+	burst := float64(bytesPerSecond) / 10
+	if burst < 4096 {
+		burst = 4096
+	}
+	return &rateLimiter{rate: float64(bytesPerSecond), burst: burst, tokens: burst, last: time.Now()}
+}
+
+// chunk is the most a single read asks for, so one large buffer does not turn into one long sleep
+func (l *rateLimiter) chunk() int {
+	return int(l.burst)
+}
+
+// wait reserves n bytes and sleeps until the bucket has paid for them
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	deficit := -l.tokens
+	l.mu.Unlock()
+
+	if deficit > 0 {
+		time.Sleep(time.Duration(deficit / l.rate * float64(time.Second)))
+	}
+}
+
+// throttledReader reads from r no faster than limiter allows
+type throttledReader struct {
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > t.limiter.chunk() {
+		p = p[:t.limiter.chunk()]
+	}
+	t.limiter.wait(len(p))
+	return t.r.Read(p)
+}
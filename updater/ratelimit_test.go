@@ -0,0 +1,38 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCopyRateLimit(t *testing.T) {
+	const (
+		rate = 1 << 20   // bytes per second
+		size = 512 << 10 // bytes copied
+	)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.bin")
+	if err := os.WriteFile(src, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	copyRateLimiter = newRateLimiter(rate)
+	defer func() { copyRateLimiter = nil }()
+
+	// The bucket starts with its burst saved up, so only the rest is paced
+	minimum := time.Duration(float64(size-int(copyRateLimiter.burst)) / rate * float64(time.Second))
+	started := time.Now()
+	if err := copyTestFile(src, filepath.Join(dir, "dst.bin")); err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(started)
+
+	if elapsed < minimum*9/10 {
+		t.Errorf("copied %d bytes in %v at --max-copy-rate %d, want at least %v", size, elapsed, rate, minimum)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "dst.bin")); err != nil || info.Size() != size {
+		t.Errorf("copy is incomplete: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// resumableJournal returns the journal of a --resumable replacement of currentPath
+// with newPath whose copy was interrupted, or nil when there is none to resume
+func resumableJournal(currentPath, newPath string) *updateJournal {
+	j, err := readJournal(currentPath)
+	if err != nil {
+		warnf("Not resuming: %v", err)
+		return nil
+	}
+	if j == nil || !j.Resumable || j.State != journalCopying || j.Swap || j.AppBundles {
+		return nil
+	}
+	if j.SourcePath != newPath {
+		warnf("An interrupted update of %s was copying %s, not %s; run --recover to undo it", currentPath, j.SourcePath, newPath)
+		return nil
+	}
+	if _, err := os.Stat(j.BackupDir); err != nil {
+		warnf("Not resuming the interrupted update of %s, its backup is gone: %v", currentPath, err)
+		return nil
+	}
+	return j
+}
+
+// resumeDirectoryReplace finishes the replacement recorded in journal, whose copy
+// was interrupted: the previous version is already in its backup, and the files the
+// journal lists as copied are kept when they are still intact
+func resumeDirectoryReplace(ctx context.Context, currentPath, newPath string, config *UpdateConfig, journal *updateJournal) (*installBackup, error) {
+	opts, err := newCopyOptions(ctx, newPath, config)
+	if err != nil {
+		return nil, err
+	}
+	opts.resumed = journal.Copied
+	journal.enableResume(opts)
+
+	infof("Resuming the interrupted copy into %s (%d files already copied, previous version in %s)",
+		currentPath, len(opts.resumed), journal.BackupDir)
+	infof("Step 3: Copying the remaining new files to current directory")
+	return copyIntoBackedUpDirectory(currentPath, newPath, journal.BackupDir, config, opts, journal)
+}
+
+// recoverResumable completes the copy of a --resumable replacement interrupted
+// while copying, instead of undoing it, with the copy settings the journal
+// recorded. A failed copy is rolled back as usual.
+func recoverResumable(j *updateJournal) error {
+	config := &UpdateConfig{
+		CurrentPath:      j.TargetPath,
+		NewPath:          j.SourcePath,
+		VerifyDuringCopy: j.Checksums,
+		Resumable:        true,
+		Preserve:         j.Preserve,
+		Exclude:          j.Exclude,
+		Ignore:           j.Ignore,
+		IncludeExt:       j.IncludeExt,
+		ExcludeExt:       j.ExcludeExt,
+		NoPreserveTimes:  j.NoPreserveTimes,
+	}
+	applyRunSettings(config)
+	wrappedBundle = j.Bundle
+	backup, err := resumeDirectoryReplace(context.Background(), j.TargetPath, j.SourcePath, config, j)
+	if err != nil {
+		return fmt.Errorf("failed to resume the copy: %w", err)
+	}
+	backup.discard()
+	return nil
+}
@@ -0,0 +1,73 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecoverResumesWithExcludedDirectory(t *testing.T) {
+	t.Cleanup(func() { applyRunSettings(&UpdateConfig{}) })
+	root := t.TempDir()
+	current := filepath.Join(root, "app")
+	newDir := filepath.Join(root, "app-new")
+	backup := filepath.Join(root, "app-backup")
+	files := map[string]string{
+		"bin/app":        "new binary",
+		"lib/libapp.so":  "new library",
+		"cache/data.bin": "regenerable cache",
+	}
+	for relPath, content := range files {
+		path := filepath.Join(newDir, filepath.FromSlash(relPath))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The previous version is in its backup and bin/app was copied before the
+	// update was killed
+	for _, dir := range []string{filepath.Join(current, "bin"), backup} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(backup, "old.txt"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(current, "bin", "app"), []byte(files["bin/app"]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	j := &updateJournal{
+		State:      journalCopying,
+		TargetPath: current,
+		SourcePath: newDir,
+		BackupDir:  backup,
+		Exclude:    []string{"cache"},
+		Resumable:  true,
+		Copied:     map[string]int64{"bin/app": int64(len(files["bin/app"]))},
+		path:       journalPath(current),
+	}
+	if err := j.write(); err != nil {
+		t.Fatal(err)
+	}
+	// Settings left over from an earlier run must not stand in for the journal's
+	applyRunSettings(&UpdateConfig{})
+
+	if err := runRecover([]string{current}); err != nil {
+		t.Fatalf("runRecover: %v", err)
+	}
+	for _, relPath := range []string{"bin/app", "lib/libapp.so"} {
+		data, err := os.ReadFile(filepath.Join(current, filepath.FromSlash(relPath)))
+		if err != nil || string(data) != files[relPath] {
+			t.Errorf("%s = %q, %v; want %q", relPath, data, err, files[relPath])
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(current, "cache")); !os.IsNotExist(err) {
+		t.Errorf("excluded cache was copied by the resumed update (stat error %v)", err)
+	}
+	if _, err := os.Lstat(journalPath(current)); !os.IsNotExist(err) {
+		t.Errorf("journal was not removed (stat error %v)", err)
+	}
+}
@@ -0,0 +1,46 @@
+//go:build linux
+
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// verifyRunningBinary confirms that pid is executing the binary currently on disk
+// rather than an old, already replaced inode that is still mapped in memory
+func verifyRunningBinary(pid int, appPath string) error {
+	exeLink := fmt.Sprintf("/proc/%d/exe", pid)
+	target, err := os.Readlink(exeLink)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", exeLink, err)
+	}
+
+	if strings.HasSuffix(target, " (deleted)") {
+		return fmt.Errorf("process %d is still running a replaced binary: %s", pid, target)
+	}
+
+	// Stat through the link reaches the mapped inode even if the path was reused
+	mapped, err := os.Stat(exeLink)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %v", exeLink, err)
+	}
+	onDisk, err := os.Stat(target)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %v", target, err)
+	}
+	if !os.SameFile(mapped, onDisk) {
+		return fmt.Errorf("process %d is running an old copy of %s", pid, target)
+	}
+
+	if relPath, err := filepath.Rel(appPath, target); err != nil || strings.HasPrefix(relPath, "..") {
+		// Typically an interpreter running a launcher script from the app directory
+		infof("Process %d runs %s from outside %s, cannot confirm it is the updated binary", pid, target, appPath)
+		return nil
+	}
+
+	infof("Confirmed process %d is running the updated binary %s", pid, target)
+	return nil
+}
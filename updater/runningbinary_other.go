@@ -0,0 +1,9 @@
+//go:build !linux
+
+package updater
+
+// verifyRunningBinary is only implemented on Linux, where /proc exposes the mapped executable
+func verifyRunningBinary(pid int, appPath string) error {
+	infof("Running-binary verification is only supported on Linux, skipping")
+	return nil
+}
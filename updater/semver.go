@@ -0,0 +1,138 @@
+package updater
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// semver is a parsed semantic version (MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD])
+type semver struct {
+	major, minor, patch int
+	prerelease          []string
+}
+
+// parseSemver parses a semantic version, accepting a leading "v". Build metadata
+// is ignored, as it does not take part in version precedence.
+func parseSemver(version string) (semver, error) {
+	s := strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+
+	var v semver
+	core := s
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		core = s[:i]
+		v.prerelease = strings.Split(s[i+1:], ".")
+		for _, identifier := range v.prerelease {
+			if identifier == "" {
+				return semver{}, fmt.Errorf("invalid version %q: empty pre-release identifier", version)
+			}
+		}
+	}
+
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return semver{}, fmt.Errorf("invalid version %q: expected MAJOR.MINOR.PATCH", version)
+	}
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return semver{}, fmt.Errorf("invalid version %q: %q is not a number", version, part)
+		}
+		numbers[i] = n
+	}
+	v.major, v.minor, v.patch = numbers[0], numbers[1], numbers[2]
+	return v, nil
+}
+
+// compare returns -1, 0 or 1 as v is lower than, equal to or higher than other
+func (v semver) compare(other semver) int {
+	for _, pair := range [][2]int{{v.major, other.major}, {v.minor, other.minor}, {v.patch, other.patch}} {
+		if c := compareInts(pair[0], pair[1]); c != 0 {
+			return c
+		}
+	}
+
+	// A pre-release ranks below the release it precedes
+	switch {
+	case len(v.prerelease) == 0 && len(other.prerelease) == 0:
+		return 0
+	case len(v.prerelease) == 0:
+		return 1
+	case len(other.prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.prerelease) && i < len(other.prerelease); i++ {
+		if c := comparePrereleaseIdentifiers(v.prerelease[i], other.prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(v.prerelease), len(other.prerelease))
+}
+
+// comparePrereleaseIdentifiers orders numeric identifiers numerically and below
+// alphanumeric ones, which are ordered lexically
+func comparePrereleaseIdentifiers(a, b string) int {
+	aNum, aErr := strconv.Atoi(a)
+	bNum, bErr := strconv.Atoi(b)
+	switch {
+	case aErr == nil && bErr == nil:
+		return compareInts(aNum, bNum)
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// compareInts returns -1, 0 or 1 as a is lower than, equal to or higher than b
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// checkVersionUpgrade reads the version file of the current and new version and
+// refuses the update unless the new one is higher, or allowDowngrade is set
+func checkVersionUpgrade(currentPath, newPath string, allowDowngrade bool) error {
+	currentVersion, newVersion := readAppVersion(currentPath), readAppVersion(newPath)
+	infof("Current version: %s, new version: %s", orUnknown(currentVersion), orUnknown(newVersion))
+	if currentVersion == "" || newVersion == "" {
+		return fmt.Errorf("cannot compare versions: %s is missing from the current or new version", appVersionFile)
+	}
+
+	current, err := parseSemver(currentVersion)
+	if err != nil {
+		return fmt.Errorf("current version: %w", err)
+	}
+	next, err := parseSemver(newVersion)
+	if err != nil {
+		return fmt.Errorf("new version: %w", err)
+	}
+
+	if next.compare(current) > 0 {
+		return nil
+	}
+	if allowDowngrade {
+		warnf("New version %s is not newer than %s, installing it anyway (--allow-downgrade)", newVersion, currentVersion)
+		return nil
+	}
+	return fmt.Errorf("new version %s is not newer than the current version %s (use --allow-downgrade to install it anyway)", newVersion, currentVersion)
+}
+
+// orUnknown returns s, or "unknown" when it is empty
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
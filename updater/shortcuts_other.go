@@ -0,0 +1,9 @@
+//go:build !windows
+
+package updater
+
+// refreshShortcuts is a no-op: only Windows keeps .lnk shortcuts to the executable
+func refreshShortcuts(appDir, appName string) error {
+	debugf("Not refreshing shortcuts to %s, only Windows has them", appDir)
+	return nil
+}
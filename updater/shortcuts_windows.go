@@ -0,0 +1,155 @@
+//go:build windows
+
+package updater
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+var (
+	shell32            = syscall.NewLazyDLL("shell32.dll")
+	procSHChangeNotify = shell32.NewProc("SHChangeNotify")
+)
+
+// shcneAssocChanged tells Explorer to drop its cached icons and shortcut targets
+const shcneAssocChanged = 0x08000000
+
+// shortcutScript rewrites the .lnk files listed one per line on standard input
+// that point into ATOM_UPDATER_APP_DIR. A shortcut whose target is gone is pointed
+// at ATOM_UPDATER_TARGET, with its icon if that came from the old target; one whose
+// target still exists is saved again so Explorer picks up the new icon. Paths never
+// have to be quoted into PowerShell source, and a long list does not run into the
+// size limit of the environment.
+const shortcutScript = `$shell = New-Object -ComObject WScript.Shell
+$root = $env:ATOM_UPDATER_APP_DIR.TrimEnd('\') + '\'
+$tab = [char]9
+foreach ($path in [Console]::In.ReadToEnd() -split [char]10) {
+  $path = $path.Trim()
+  if (-not $path) { continue }
+  try {
+    $link = $shell.CreateShortcut($path)
+    $target = $link.TargetPath
+    if (-not $target.StartsWith($root, [StringComparison]::OrdinalIgnoreCase)) { continue }
+    if (Test-Path -LiteralPath $target) {
+      $link.Save()
+      Write-Output ("refreshed" + $tab + $path)
+      continue
+    }
+    $link.TargetPath = $env:ATOM_UPDATER_TARGET
+    if ($link.IconLocation.StartsWith($target, [StringComparison]::OrdinalIgnoreCase)) {
+      $link.IconLocation = $env:ATOM_UPDATER_TARGET + ',0'
+    }
+    $link.Save()
+    Write-Output ("retargeted" + $tab + $path + $tab + $target)
+  } catch {
+    Write-Output ("failed" + $tab + $path + $tab + $_.Exception.Message)
+  }
+}`
+
+// shortcutDirs returns the folders holding the Start menu, desktop and pinned
+// taskbar shortcuts of the current user and of all users
+func shortcutDirs() []string {
+	var dirs []string
+	if appData := os.Getenv("APPDATA"); appData != "" {
+		dirs = append(dirs,
+			filepath.Join(appData, `Microsoft\Windows\Start Menu`),
+			filepath.Join(appData, `Microsoft\Internet Explorer\Quick Launch`))
+	}
+	if programData := os.Getenv("ProgramData"); programData != "" {
+		dirs = append(dirs, filepath.Join(programData, `Microsoft\Windows\Start Menu`))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, "Desktop"))
+	}
+	if public := os.Getenv("PUBLIC"); public != "" {
+		dirs = append(dirs, filepath.Join(public, "Desktop"))
+	}
+	return dirs
+}
+
+// findShortcuts lists the .lnk files under dirs. Folders that are missing or
+// unreadable are skipped.
+func findShortcuts(dirs []string) []string {
+	var shortcuts []string
+	for _, dir := range dirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if !d.IsDir() && strings.EqualFold(filepath.Ext(path), ".lnk") {
+				shortcuts = append(shortcuts, path)
+			}
+			return nil
+		})
+	}
+	return shortcuts
+}
+
+// refreshShortcuts updates the Start menu, desktop and taskbar shortcuts that
+// point into appDir after it was replaced: shortcuts to an executable the new
+// version no longer has are pointed at the one it launches, and the others are
+// saved again, then Explorer is told to refresh its cached icons
+func refreshShortcuts(appDir, appName string) error {
+	if info, err := os.Stat(appDir); err != nil || !info.IsDir() {
+		// A single executable keeps its path, so its shortcuts stay valid
+		debugf("Not refreshing shortcuts, %s is not a directory", appDir)
+		return nil
+	}
+	shortcuts := findShortcuts(shortcutDirs())
+	if len(shortcuts) == 0 {
+		debugf("No shortcuts found to refresh")
+		return nil
+	}
+
+	target, err := findExecutableInDirectory(appDir, appNameCandidates(appName))
+	if err != nil {
+		return fmt.Errorf("failed to find the executable shortcuts should start: %w", err)
+	}
+
+	infof("Refreshing shortcuts to %s (%d shortcuts to check)", appDir, len(shortcuts))
+	var stdout, stderr bytes.Buffer
+	cmd := newHelperCommand("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", shortcutScript)
+	defer cmd.done()
+	cmd.Env = append(os.Environ(),
+		"ATOM_UPDATER_APP_DIR="+appDir,
+		"ATOM_UPDATER_TARGET="+target)
+	cmd.Stdin = strings.NewReader(strings.Join(shortcuts, "\n"))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	if err := cmd.Run(); err != nil {
+		if cmd.expired() {
+			return cmd.timedOut(err)
+		}
+		return fmt.Errorf("failed to update shortcuts: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	refreshed, retargeted := 0, 0
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), "\t")
+		switch {
+		case fields[0] == "refreshed" && len(fields) == 2:
+			debugf("Refreshed shortcut %s", fields[1])
+			refreshed++
+		case fields[0] == "retargeted" && len(fields) == 3:
+			infof("Pointed shortcut %s at %s (was %s)", fields[1], target, fields[2])
+			retargeted++
+		case fields[0] == "failed" && len(fields) == 3:
+			warnf("Failed to update shortcut %s: %s", fields[1], fields[2])
+		}
+	}
+
+	if refreshed+retargeted > 0 {
+		procSHChangeNotify.Call(shcneAssocChanged, 0, 0, 0)
+	}
+	infof("Shortcuts: %d refreshed, %d pointed at the new executable", refreshed, retargeted)
+	return nil
+}
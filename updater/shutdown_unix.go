@@ -0,0 +1,40 @@
+//go:build !windows
+
+package updater
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// defaultShutdownSignal is sent when no --shutdown-signal is given
+const defaultShutdownSignal = "SIGTERM"
+
+// shutdownSignals lists the signals accepted by --shutdown-signal
+var shutdownSignals = map[string]syscall.Signal{
+	"SIGTERM": syscall.SIGTERM,
+	"SIGINT":  syscall.SIGINT,
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+}
+
+// sendShutdownRequest politely asks pid to quit using the named signal
+func sendShutdownRequest(pid int, signal string) error {
+	name := strings.ToUpper(signal)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	sig, ok := shutdownSignals[name]
+	if !ok {
+		return fmt.Errorf("unsupported shutdown signal %q", signal)
+	}
+
+	if err := syscall.Kill(pid, sig); err != nil {
+		return fmt.Errorf("failed to send %s to process %d: %v", name, pid, err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+//go:build windows
+
+package updater
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// defaultShutdownSignal is sent when no --shutdown-signal is given
+const defaultShutdownSignal = "WM_CLOSE"
+
+const (
+	wmClose          = 0x0010 // WM_CLOSE
+	eventModifyState = 0x0002 // EVENT_MODIFY_STATE
+)
+
+var (
+	user32                       = syscall.NewLazyDLL("user32.dll")
+	procEnumWindows              = user32.NewProc("EnumWindows")
+	procGetWindowThreadProcessId = user32.NewProc("GetWindowThreadProcessId")
+	procPostMessageW             = user32.NewProc("PostMessageW")
+
+	kernel32       = syscall.NewLazyDLL("kernel32.dll")
+	procOpenEventW = kernel32.NewProc("OpenEventW")
+	procSetEvent   = kernel32.NewProc("SetEvent")
+)
+
+// sendShutdownRequest politely asks pid to quit. Supported signals are
+// "WM_CLOSE" (posted to every top-level window of the process) and
+// "event:<name>" (sets a named event the application waits on).
+func sendShutdownRequest(pid int, signal string) error {
+	if strings.EqualFold(signal, "WM_CLOSE") {
+		return postCloseToWindows(pid)
+	}
+
+	if strings.HasPrefix(strings.ToLower(signal), "event:") {
+		return setNamedEvent(signal[len("event:"):])
+	}
+
+	return fmt.Errorf("unsupported shutdown signal %q (use WM_CLOSE or event:<name>)", signal)
+}
+
+// postCloseToWindows posts WM_CLOSE to all top-level windows owned by pid
+func postCloseToWindows(pid int) error {
+	posted := 0
+	callback := syscall.NewCallback(func(hwnd uintptr, lparam uintptr) uintptr {
+		var windowPID uint32
+		procGetWindowThreadProcessId.Call(hwnd, uintptr(unsafe.Pointer(&windowPID)))
+		if int(windowPID) == pid {
+			procPostMessageW.Call(hwnd, wmClose, 0, 0)
+			posted++
+		}
+		return 1 // continue enumeration
+	})
+	procEnumWindows.Call(callback, 0)
+
+	if posted == 0 {
+		return fmt.Errorf("process %d has no top-level windows to close", pid)
+	}
+	return nil
+}
+
+// setNamedEvent signals the named event an application waits on to shut down
+func setNamedEvent(name string) error {
+	namePtr, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+
+	handle, _, callErr := procOpenEventW.Call(eventModifyState, 0, uintptr(unsafe.Pointer(namePtr)))
+	if handle == 0 {
+		return fmt.Errorf("failed to open event %s: %v", name, callErr)
+	}
+	defer syscall.CloseHandle(syscall.Handle(handle))
+
+	if ok, _, callErr := procSetEvent.Call(handle); ok == 0 {
+		return fmt.Errorf("failed to set event %s: %v", name, callErr)
+	}
+	return nil
+}
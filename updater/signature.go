@@ -0,0 +1,56 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// signatureTargets returns what --verify-signature checks in newPath: every
+// top-level .app bundle, or else the executable that will be launched
+func signatureTargets(newPath string, config *UpdateConfig) ([]string, error) {
+	info, err := os.Stat(newPath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{newPath}, nil
+	}
+
+	entries, err := os.ReadDir(newPath)
+	if err != nil {
+		return nil, err
+	}
+	var targets []string
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasSuffix(entry.Name(), ".app") {
+			targets = append(targets, filepath.Join(newPath, entry.Name()))
+		}
+	}
+	if len(targets) > 0 {
+		return targets, nil
+	}
+
+	executable, err := findExecutableInDirectory(newPath, appNameCandidates(config.AppName))
+	if err != nil {
+		return nil, fmt.Errorf("nothing to verify: %w", err)
+	}
+	return []string{executable}, nil
+}
+
+// verifyNewVersionSignature checks the code signature of everything
+// signatureTargets selects in newPath, stopping at the first failure
+func verifyNewVersionSignature(newPath string, config *UpdateConfig) error {
+	targets, err := signatureTargets(newPath, config)
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		infof("Verifying code signature of %s", target)
+		if err := verifyCodeSignature(target, config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package updater
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// verifyCodeSignature runs codesign on path and fails unless it carries a valid
+// signature, made by --require-team-id when one is given
+func verifyCodeSignature(path string, config *UpdateConfig) error {
+	var output bytes.Buffer
+	cmd := newHelperCommand("codesign", "--verify", "--deep", "--strict", path)
+	defer cmd.done()
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		if cmd.expired() {
+			return cmd.timedOut(err)
+		}
+		return fmt.Errorf("%s is unsigned or its signature is invalid: %s", path, strings.TrimSpace(output.String()))
+	}
+
+	teamID := config.RequireTeamID
+	if teamID == "" {
+		return nil
+	}
+
+	// codesign -dv prints the signing details, TeamIdentifier among them, to stderr
+	output.Reset()
+	details := newHelperCommand("codesign", "-dv", path)
+	defer details.done()
+	details.Stdout = &output
+	details.Stderr = &output
+	if err := details.Run(); err != nil {
+		if details.expired() {
+			return details.timedOut(err)
+		}
+		return fmt.Errorf("failed to read signing details of %s: %s", path, strings.TrimSpace(output.String()))
+	}
+
+	signedBy := ""
+	for _, line := range strings.Split(output.String(), "\n") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), "TeamIdentifier="); ok {
+			signedBy = value
+			break
+		}
+	}
+	if signedBy != teamID {
+		return fmt.Errorf("%s is signed by team '%s', expected '%s'", path, signedBy, teamID)
+	}
+	debugf("%s is signed by team %s", path, signedBy)
+	return nil
+}
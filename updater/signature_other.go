@@ -0,0 +1,14 @@
+//go:build !darwin && !windows
+
+package updater
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// verifyCodeSignature is unsupported here; a requested check fails rather than
+// letting an unverified version through
+func verifyCodeSignature(path string, config *UpdateConfig) error {
+	return fmt.Errorf("code signature verification is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,71 @@
+//go:build windows
+
+package updater
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// authenticodeScript prints the Authenticode status and signer subject of the
+// file named by ATOM_UPDATER_SIGNED_PATH. The path goes through the environment
+// so it never has to be quoted into PowerShell source.
+const authenticodeScript = `$s = Get-AuthenticodeSignature -LiteralPath $env:ATOM_UPDATER_SIGNED_PATH
+Write-Output $s.Status
+if ($s.SignerCertificate) { Write-Output $s.SignerCertificate.Subject }`
+
+// verifyCodeSignature checks the Authenticode signature of path with PowerShell's
+// Get-AuthenticodeSignature and fails unless it is valid and, when
+// --require-publisher is given, issued to that publisher
+func verifyCodeSignature(path string, config *UpdateConfig) error {
+	var stdout, stderr bytes.Buffer
+	cmd := newHelperCommand("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", authenticodeScript)
+	defer cmd.done()
+	cmd.Env = append(os.Environ(), "ATOM_UPDATER_SIGNED_PATH="+path)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	if err := cmd.Run(); err != nil {
+		if cmd.expired() {
+			return cmd.timedOut(err)
+		}
+		return fmt.Errorf("failed to check the Authenticode signature of %s: %v: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	status := strings.TrimSpace(lines[0])
+	if status != "Valid" {
+		return fmt.Errorf("%s does not have a valid Authenticode signature (status %s)", path, status)
+	}
+
+	if config.RequirePublisher == "" {
+		return nil
+	}
+	subject := ""
+	if len(lines) > 1 {
+		subject = strings.TrimSpace(lines[1])
+	}
+	if !subjectNames(subject, config.RequirePublisher) {
+		return fmt.Errorf("%s is signed by '%s', expected publisher '%s'", path, subject, config.RequirePublisher)
+	}
+	debugf("%s is signed by %s", path, subject)
+	return nil
+}
+
+// subjectNames reports whether the certificate subject ("CN=Example Ltd, O=Example Ltd, C=US")
+// names publisher as its common name or organization
+func subjectNames(subject, publisher string) bool {
+	for _, part := range strings.Split(subject, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || (key != "CN" && key != "O") {
+			continue
+		}
+		if strings.EqualFold(strings.Trim(value, `"`), publisher) {
+			return true
+		}
+	}
+	return false
+}
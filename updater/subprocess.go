@@ -0,0 +1,53 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// defaultSubprocessTimeout is how long a helper command may run without --subprocess-timeout
+const defaultSubprocessTimeout = 120 * time.Second
+
+// subprocessTimeout bounds the helper commands the updater runs and waits for
+// (ditto, open, codesign, xattr, chattr, ps, PowerShell), so a hung one cannot
+// wedge an unattended update. The launched application itself is not bounded.
+var subprocessTimeout = defaultSubprocessTimeout
+
+// helperCommand is an exec.Cmd that is killed once subprocessTimeout has passed
+type helperCommand struct {
+	*exec.Cmd
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// newHelperCommand prepares name to run with args under subprocessTimeout. The
+// caller must call done once the command has finished.
+func newHelperCommand(name string, args ...string) *helperCommand {
+	ctx, cancel := context.WithTimeout(context.Background(), subprocessTimeout)
+	cmd := exec.CommandContext(ctx, name, args...)
+	// A grandchild holding the output pipes open must not stall Wait after the kill
+	cmd.WaitDelay = time.Second
+	return &helperCommand{Cmd: cmd, ctx: ctx, cancel: cancel}
+}
+
+// done releases the timer of the command
+func (c *helperCommand) done() {
+	c.cancel()
+}
+
+// expired reports whether the command ran past subprocessTimeout
+func (c *helperCommand) expired() bool {
+	return c.ctx.Err() == context.DeadlineExceeded
+}
+
+// timedOut replaces err with a clear message when the command was killed for
+// running past subprocessTimeout, and returns it unchanged otherwise
+func (c *helperCommand) timedOut(err error) error {
+	if err != nil && c.expired() {
+		return fmt.Errorf("%s did not finish within %v and was killed (see --subprocess-timeout)", filepath.Base(c.Path), subprocessTimeout)
+	}
+	return err
+}
@@ -0,0 +1,134 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Final statuses reported in the run summary
+const (
+	summarySuccess    = "success"
+	summaryFailed     = "failed"
+	summaryRolledBack = "rolled_back"
+	summaryCancelled  = "cancelled"
+)
+
+// updateSummary is the JSON object printed to stdout by --json-summary
+type updateSummary struct {
+	Status      string `json:"status"`
+	ExitCode    int    `json:"exit_code"`
+	AppType     string `json:"app_type,omitempty"`
+	FilesCopied int    `json:"files_copied"`
+	BytesCopied int64  `json:"bytes_copied"`
+	DurationMS  int64  `json:"duration_ms"`
+	RolledBack  bool   `json:"rolled_back"`
+	LaunchedPID int    `json:"launched_pid,omitempty"`
+	BackupPath  string `json:"backup_path,omitempty"`
+	DryRun      bool   `json:"dry_run,omitempty"`
+	Error       string `json:"error,omitempty"`
+
+	CopyFailures []copyFailure `json:"copy_failures,omitempty"`
+}
+
+// copyFailure is a file --best-effort left out because it could not be copied
+type copyFailure struct {
+	Path  string `json:"path"` // relative to the new version
+	Error string `json:"error"`
+}
+
+// runStats collects what happened during the current update. Copies may be
+// counted from several goroutines, so every access goes through mu.
+type runStats struct {
+	mu      sync.Mutex
+	started time.Time
+	summary updateSummary
+}
+
+// runSummary holds the statistics of the update in progress
+var runSummary runStats
+
+// reset starts collecting statistics for a new update
+func (s *runStats) reset(dryRun bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.started = time.Now()
+	s.summary = updateSummary{DryRun: dryRun}
+}
+
+// update applies fn to the summary under the lock
+func (s *runStats) update(fn func(*updateSummary)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.summary)
+}
+
+// recordCopy counts files and bytes installed from the new version
+func (s *runStats) recordCopy(files int, bytes int64) {
+	s.update(func(sum *updateSummary) {
+		sum.FilesCopied += files
+		sum.BytesCopied += bytes
+	})
+}
+
+// recordCopyFailure adds a file left out by --best-effort
+func (s *runStats) recordCopyFailure(failure copyFailure) {
+	s.update(func(sum *updateSummary) { sum.CopyFailures = append(sum.CopyFailures, failure) })
+}
+
+// recordRollback notes that the previous version was restored
+func (s *runStats) recordRollback() {
+	s.update(func(sum *updateSummary) { sum.RolledBack = true })
+}
+
+// finish completes the summary with the outcome of the update
+func (s *runStats) finish(err error) updateSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sum := s.summary
+	if !s.started.IsZero() {
+		sum.DurationMS = time.Since(s.started).Milliseconds()
+	}
+	sum.ExitCode = ExitCode(err)
+	switch {
+	case err == nil:
+		sum.Status = summarySuccess
+		return sum
+	case sum.ExitCode == ExitCancelled:
+		sum.Status = summaryCancelled
+	case sum.RolledBack:
+		sum.Status = summaryRolledBack
+	default:
+		sum.Status = summaryFailed
+	}
+	sum.Error = err.Error()
+	return sum
+}
+
+// printSuccess writes the one-line result of a successful update to stdout for
+// people and scripts, e.g. "Updated /opt/app (120 files, 48213 bytes in 2.1s)"
+func printSuccess(config *UpdateConfig) {
+	sum := runSummary.finish(nil)
+	if sum.BackupPath != "" {
+		// --keep-backup already printed the kept path, the line scripts read
+		return
+	}
+	verb := "Updated"
+	if sum.DryRun {
+		verb = "Dry run complete, nothing changed in"
+	}
+	elapsed := time.Duration(sum.DurationMS) * time.Millisecond
+	fmt.Printf("%s %s (%d files, %d bytes in %v)\n", verb, config.CurrentPath, sum.FilesCopied, sum.BytesCopied, elapsed.Round(100*time.Millisecond))
+}
+
+// printSummary writes the run summary as a single JSON line to stdout
+func printSummary(err error) {
+	data, marshalErr := json.Marshal(runSummary.finish(err))
+	if marshalErr != nil {
+		warnf("failed to encode run summary: %v", marshalErr)
+		return
+	}
+	fmt.Println(string(data))
+}
@@ -0,0 +1,201 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// journalSwapping is the state of a --swap replacement between its two renames
+const journalSwapping = "swapping"
+
+// swapUnsupported returns why currentPath cannot be replaced by --swap, or "" when it can
+func swapUnsupported(currentPath string, config *UpdateConfig) string {
+	info, err := os.Lstat(currentPath)
+	if err != nil {
+		return err.Error()
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return "current_dir is a symlink"
+	}
+	if preserving() {
+		return "--preserve or --auto-wrap-bundle keeps paths inside current_dir"
+	}
+	if isMountPoint(currentPath) {
+		return "current_dir is a mount point"
+	}
+
+	parent := filepath.Dir(currentPath)
+	parentDev, _, err := fileIdentity(parent)
+	if err != nil {
+		return err.Error()
+	}
+	if config.BackupDir != "" {
+		backupDev, _, err := fileIdentity(config.BackupDir)
+		if err != nil {
+			return err.Error()
+		}
+		if backupDev != parentDev {
+			return "--backup-dir is on another filesystem"
+		}
+	}
+	return ""
+}
+
+// swapBackupDir returns where --swap moves the current version: beside it, or
+// under --backup-dir when one is set, else --tmp-dir when it is on the same filesystem
+func swapBackupDir(currentPath string, config *UpdateConfig) string {
+	if config.BackupDir == "" {
+		return tempDirPath(generateTempFilename(currentPath, "old"), true)
+	}
+	return filepath.Join(config.BackupDir, filepath.Base(currentPath)+generateTempFilename("", "old"))
+}
+
+// atomicSwapReplace installs the new version into a staging directory beside
+// currentPath and then swaps it in with two renames, so the application directory
+// is never seen half-populated. The previous version is returned as the backup.
+func atomicSwapReplace(ctx context.Context, currentPath, newPath string, config *UpdateConfig) (*installBackup, error) {
+	infof("Starting directory swap: %s -> %s", newPath, currentPath)
+
+	info, err := os.Stat(currentPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat current directory: %v", err)
+	}
+	opts, err := newCopyOptions(ctx, newPath, config)
+	if err != nil {
+		return nil, err
+	}
+
+	stagingDir := generateTempFilename(currentPath, "new")
+	backupDir := swapBackupDir(currentPath, config)
+	journal := startJournal(currentPath, newPath, backupDir, false, config)
+	if journal != nil {
+		journal.Swap = true
+		journal.StagingDir = stagingDir
+		journal.advance(journalCopying)
+	}
+	discardStaging := func() {
+		if err := removeAllRetrying(stagingDir); err != nil {
+			warnf("Failed to remove staging directory %s: %v", stagingDir, err)
+		}
+		journal.remove()
+	}
+
+	// Step 1: Build the new version next to the current one, which stays untouched
+	infof("Step 1: Copying new version to %s", stagingDir)
+	err = os.Mkdir(stagingDir, info.Mode().Perm())
+	if err == nil {
+		err = copyDirectoryTree(newPath, stagingDir, opts)
+	}
+	if err == nil {
+		err = injectFailure(phaseCopy)
+	}
+	if err == nil {
+		err = verifyInstalledTree(stagingDir, config, opts)
+	}
+	if err != nil {
+		warnf("Failed to stage new version, leaving the current one in place: %v", err)
+		discardStaging()
+		return nil, fmt.Errorf("failed to stage new version: %w", err)
+	}
+
+	// Step 2: Swap the directories
+	infof("Step 2: Swapping %s into place, previous version to %s", stagingDir, backupDir)
+	journal.advance(journalSwapping)
+	if err := renameRetrying(currentPath, backupDir); err != nil {
+		discardStaging()
+		return nil, fmt.Errorf("failed to move current version aside: %v", err)
+	}
+	err = renameRetrying(stagingDir, currentPath)
+	if err == nil {
+		err = injectFailure(phaseFinalize)
+	}
+	if err != nil {
+		warnf("Failed to move new version into place, restoring: %v", err)
+		if rollbackErr := swapBack(currentPath, backupDir); rollbackErr != nil {
+			errorf("Rollback failed, previous version kept at %s: %v", backupDir, rollbackErr)
+			return nil, fmt.Errorf("failed to swap in new version: %w", withRollbackFailure(err, rollbackErr))
+		}
+		runSummary.recordRollback()
+		discardStaging()
+		return nil, fmt.Errorf("failed to swap in new version: %w", err)
+	}
+
+	syncDirLogged(filepath.Dir(currentPath))
+	if filepath.Dir(backupDir) != filepath.Dir(currentPath) {
+		syncDirLogged(filepath.Dir(backupDir))
+	}
+	infof("Directory swap completed successfully")
+	journal.advance(journalInstalled)
+
+	return &installBackup{
+		dir:     backupDir,
+		journal: journal,
+		rollback: func() error {
+			journal.advance(journalRestoring)
+			if err := swapBack(currentPath, backupDir); err != nil {
+				return err
+			}
+			journal.remove()
+			return nil
+		},
+	}, nil
+}
+
+// swapBack renames backupDir to currentPath, discarding whatever is at currentPath
+func swapBack(currentPath, backupDir string) error {
+	if _, err := os.Lstat(currentPath); err == nil {
+		discarded := generateTempFilename(currentPath, "tmp")
+		if err := renameRetrying(currentPath, discarded); err != nil {
+			return fmt.Errorf("failed to move %s aside: %v", currentPath, err)
+		}
+		if err := renameRetrying(backupDir, currentPath); err != nil {
+			// Put back what was there rather than leave nothing
+			renameRetrying(discarded, currentPath)
+			return fmt.Errorf("failed to move %s back into place: %v", backupDir, err)
+		}
+		if err := removeAllRetrying(discarded); err != nil {
+			warnf("Failed to remove %s: %v", discarded, err)
+		}
+	} else if err := renameRetrying(backupDir, currentPath); err != nil {
+		return fmt.Errorf("failed to move %s back into place: %v", backupDir, err)
+	}
+
+	syncDirLogged(filepath.Dir(currentPath))
+	return nil
+}
+
+// recoverSwap finishes or undoes an interrupted --swap replacement. Only the
+// renames change what is at TargetPath, so its presence says how far the swap got.
+func recoverSwap(j *updateJournal) error {
+	_, targetErr := os.Lstat(j.TargetPath)
+	_, backupErr := os.Lstat(j.BackupDir)
+
+	switch {
+	case os.IsNotExist(backupErr):
+		// The current version was never moved aside, or the backup was already cleaned up
+		infof("Previous version is still in place, removing staging directory %s", j.StagingDir)
+		if err := os.RemoveAll(j.StagingDir); err != nil {
+			return fmt.Errorf("failed to remove staging directory: %v", err)
+		}
+
+	case os.IsNotExist(targetErr), j.State == journalRestoring:
+		infof("Moving the previous version back from %s", j.BackupDir)
+		if err := swapBack(j.TargetPath, j.BackupDir); err != nil {
+			return fmt.Errorf("failed to restore backup: %v", err)
+		}
+		os.RemoveAll(j.StagingDir)
+
+	default:
+		// Both renames happened: the new version is in place
+		infof("New version is fully installed, removing backup %s", j.BackupDir)
+		if err := os.RemoveAll(j.BackupDir); err != nil {
+			return fmt.Errorf("failed to remove backup: %v", err)
+		}
+	}
+
+	j.remove()
+	infof("Recovery of %s completed", j.TargetPath)
+	return nil
+}
@@ -0,0 +1,98 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// expandTargets returns the installs a current_dir names. A pattern such as
+// /opt/myapp-* is expanded with filepath.Glob; any other path, including one that
+// exists under its literal name, is the only target. newPath is never a target
+// even when the pattern matches it.
+func expandTargets(currentPath, newPath string) ([]string, error) {
+	if !strings.ContainsAny(currentPath, "*?[") {
+		return []string{currentPath}, nil
+	}
+	if _, err := os.Lstat(currentPath); err == nil {
+		return []string{currentPath}, nil
+	}
+
+	matches, err := filepath.Glob(currentPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid current_dir pattern '%s': %v", currentPath, err)
+	}
+	absNew, _ := filepath.Abs(newPath)
+	var targets []string
+	for _, match := range matches {
+		if absMatch, err := filepath.Abs(match); err == nil && absMatch == absNew {
+			infof("Skipping %s: it is new_dir", match)
+			continue
+		}
+		targets = append(targets, match)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("current_dir pattern '%s' matches no installs", currentPath)
+	}
+	return targets, nil
+}
+
+// runTarget updates one install and reports its outcome on stdout
+func runTarget(ctx context.Context, config UpdateConfig) error {
+	err := UpdateContext(ctx, config)
+	if config.JSONSummary {
+		printSummary(err)
+	} else if err == nil && !config.Quiet && !config.Silent {
+		printSuccess(&config)
+	}
+	return err
+}
+
+// runTargets updates every install in targets from the same new_dir, one after
+// another. A failed install does not stop the others unless --fail-fast is given;
+// the returned error carries the exit code of the first failure.
+func runTargets(ctx context.Context, config *UpdateConfig, targets []string) error {
+	infof("current_dir pattern %s matches %d installs", config.CurrentPath, len(targets))
+
+	var failed []string
+	var firstErr error
+	updated := 0
+	for i, target := range targets {
+		if ctx.Err() != nil {
+			break
+		}
+		infof("=== Updating install %d of %d: %s ===", i+1, len(targets), target)
+		targetConfig := *config
+		targetConfig.CurrentPath = target
+		if err := runTarget(ctx, targetConfig); err != nil {
+			errorf("Failed to update %s: %v", target, err)
+			failed = append(failed, target)
+			if firstErr == nil {
+				firstErr = err
+			}
+			if config.FailFast {
+				warnf("Stopping after the first failure (--fail-fast)")
+				break
+			}
+			continue
+		}
+		updated++
+	}
+
+	infof("=== Updated %d of %d installs ===", updated, len(targets))
+	for _, target := range failed {
+		infof("  failed: %s", target)
+	}
+	if skipped := len(targets) - updated - len(failed); skipped > 0 {
+		infof("  not attempted: %d", skipped)
+	}
+	if firstErr != nil {
+		return withExitCode(ExitCode(firstErr), fmt.Errorf("%d of %d installs failed to update, first: %w", len(failed), len(targets), firstErr))
+	}
+	if ctx.Err() != nil {
+		return withExitCode(ExitCancelled, fmt.Errorf("update cancelled after %d of %d installs: %w", updated, len(targets), ctx.Err()))
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// atomicTypeChangeReplace replaces a single file with a directory or a directory
+// with a single file, as allowed by --force for packaging changes between versions.
+// Either way the result has directory-replace semantics: a new directory takes the
+// place of the file, and a new file is installed as the only entry of the directory.
+func atomicTypeChangeReplace(ctx context.Context, currentPath, newPath string, currentType ApplicationType, config *UpdateConfig) (*installBackup, error) {
+	if isFileType(currentType) {
+		return replaceFileWithDirectory(ctx, currentPath, newPath, config)
+	}
+
+	// Stage the file as a one-entry directory (under --tmp-dir when given) and
+	// replace the directory with it
+	stageDir, err := os.MkdirTemp(tempDir, "atom-updater-stage-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %v", err)
+	}
+	defer os.RemoveAll(stageDir)
+
+	stagedPath := filepath.Join(stageDir, filepath.Base(newPath))
+	infof("Staging %s as %s", newPath, stagedPath)
+	if err := copyFileRetrying(newPath, stagedPath); err != nil {
+		return nil, fmt.Errorf("failed to stage new version: %v", err)
+	}
+	return atomicDirectoryReplace(ctx, currentPath, stageDir, config)
+}
+
+// replaceFileWithDirectory moves the current file aside and installs the new
+// directory in its place. The file is returned as the backup.
+func replaceFileWithDirectory(ctx context.Context, currentPath, newPath string, config *UpdateConfig) (*installBackup, error) {
+	infof("Starting file to directory replacement: %s -> %s", newPath, currentPath)
+
+	_, bytes, err := measureTree(newPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure new directory: %v", err)
+	}
+	if err := checkFreeSpace(filepath.Dir(currentPath), bytes, config.MinFreeBytes); err != nil {
+		return nil, err
+	}
+
+	opts, err := newCopyOptions(ctx, newPath, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 1: Move the current file aside
+	backupFile := generateTempFilename(currentPath, "tmp")
+	infof("Step 1: Backing up current version to %s", backupFile)
+	if err := renameOrCopy(currentPath, backupFile); err != nil {
+		return nil, fmt.Errorf("failed to backup current version: %v", err)
+	}
+	restore := func() error {
+		if err := removeAllRetrying(currentPath); err != nil {
+			return fmt.Errorf("failed to remove new directory: %v", err)
+		}
+		return renameOrCopy(backupFile, currentPath)
+	}
+
+	// Step 2: Copy the new directory into place and verify it
+	infof("Step 2: Copying new directory to %s", currentPath)
+	err = os.Mkdir(currentPath, 0755)
+	if err == nil {
+		err = copyDirectoryTree(newPath, currentPath, opts)
+	}
+	if err == nil {
+		err = verifyInstalledTree(currentPath, config, opts)
+	}
+	if err != nil {
+		warnf("Failed to install new directory, rolling back: %v", err)
+		if rollbackErr := restore(); rollbackErr != nil {
+			errorf("Rollback failed, previous version kept at %s: %v", backupFile, rollbackErr)
+			err = withRollbackFailure(err, rollbackErr)
+		} else {
+			runSummary.recordRollback()
+		}
+		return nil, fmt.Errorf("failed to install new directory: %w", err)
+	}
+
+	syncDirLogged(filepath.Dir(currentPath))
+	infof("File to directory replacement completed successfully")
+	return &installBackup{dir: backupFile, rollback: restore}, nil
+}
@@ -0,0 +1,3473 @@
+package updater
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version is the current version of atom-updater
+const Version = "v2.0.0"
+
+// Application types
+type ApplicationType int
+
+const (
+	SingleFile ApplicationType = iota
+	MacAppBundle
+	MacAppBundleDirectory // Directory containing .app bundles
+	MacDirectory
+	WindowsAppDirectory
+	LinuxAppDirectory
+	GenericDirectory
+	LinuxAppImage // Executable .AppImage file, launched directly
+)
+
+// UpdateConfig holds configuration for the update process
+type UpdateConfig struct {
+	PID             int      `json:"pid"`
+	CurrentPath     string   `json:"current_path"`
+	NewPath         string   `json:"new_path"`
+	AppName         string   `json:"app_name,omitempty"`
+	Timeout         int      `json:"timeout,omitempty"`
+	TimeoutAction   string   `json:"timeout_action,omitempty"`
+	TimeoutExitCode int      `json:"timeout_exit_code,omitempty"`
+	VerifyChecksum  bool     `json:"verify_checksum"`
+	Checksum        string   `json:"checksum,omitempty"`
+	HealthCheckURL  string   `json:"health_check_url,omitempty"`
+	HandoffSocket   string   `json:"handoff_socket,omitempty"`
+	HandoffTimeout  int      `json:"handoff_timeout,omitempty"`
+	Verbose         bool     `json:"verbose,omitempty"`
+	MakeExecutable  []string `json:"make_executable,omitempty"`
+	RequirePaths    []string `json:"require_paths,omitempty"`
+	Preserve        []string `json:"preserve,omitempty"`
+	Exclude         []string `json:"exclude,omitempty"`
+
+	GracefulShutdown bool   `json:"graceful_shutdown,omitempty"`
+	ShutdownSignal   string `json:"shutdown_signal,omitempty"`
+	ShutdownTimeout  int    `json:"shutdown_timeout,omitempty"`
+	ForceKill        bool   `json:"force_kill,omitempty"`
+	TerminatePID     bool   `json:"terminate_pid,omitempty"`
+
+	ExecSearchDepth      int      `json:"exec_search_depth,omitempty"`
+	Ignore               []string `json:"ignore,omitempty"`
+	NewerOnly            bool     `json:"newer_only,omitempty"`
+	IncludeExt           []string `json:"include_ext,omitempty"`
+	ExcludeExt           []string `json:"exclude_ext,omitempty"`
+	VerifySourceReadable bool     `json:"verify_source_readable,omitempty"`
+	StrictIdentity       bool     `json:"strict_identity,omitempty"`
+	PreserveMTime        bool     `json:"preserve_mtime,omitempty"` // the default now, kept for older configs
+	NoPreserveTimes      bool     `json:"no_preserve_times,omitempty"`
+	VerifyDuringCopy     bool     `json:"verify_during_copy,omitempty"`
+	ChecksumCache        string   `json:"checksum_cache,omitempty"`
+	VerifySignature      bool     `json:"verify_signature,omitempty"`
+	RequireTeamID        string   `json:"require_team_id,omitempty"`
+	RequirePublisher     string   `json:"require_publisher,omitempty"`
+
+	UpdateMarker        string `json:"update_marker,omitempty"`
+	VerifyRunningBinary bool   `json:"verify_running_binary,omitempty"`
+	VerifyPIDOwnsPath   bool   `json:"verify_pid_owns_path,omitempty"`
+	StrictPIDCheck      bool   `json:"strict_pid_check,omitempty"`
+	Harden              bool   `json:"harden,omitempty"`
+	DryRun              bool   `json:"dry_run,omitempty"`
+	JSONSummary         bool   `json:"json_summary,omitempty"`
+	WaitProcessName     string `json:"wait_process_name,omitempty"`
+	NoWait              bool   `json:"no_wait,omitempty"`
+	VerifyAfterCopy     bool   `json:"verify_after_copy,omitempty"`
+	Force               bool   `json:"force,omitempty"`
+	PIDFile             string `json:"pid_file,omitempty"`
+	ClearQuarantine     bool   `json:"clear_quarantine,omitempty"`
+	RefreshShortcuts    bool   `json:"refresh_shortcuts,omitempty"`
+	CompareVersions     bool   `json:"compare_versions,omitempty"`
+	AllowDowngrade      bool   `json:"allow_downgrade,omitempty"`
+	VersionFile         string `json:"version_file,omitempty"`
+	CopyBufferSize      int    `json:"copy_buffer_size,omitempty"`
+	CopyFileRange       bool   `json:"copy_file_range,omitempty"`
+	CopyConcurrency     int    `json:"copy_concurrency,omitempty"`
+	MaxCopyRate         int64  `json:"max_copy_rate,omitempty"`
+	SubprocessTimeout   int    `json:"subprocess_timeout,omitempty"`
+	Resumable           bool   `json:"resumable,omitempty"`
+	BestEffort          bool   `json:"best_effort,omitempty"`
+	MaxFailures         int    `json:"max_failures,omitempty"`
+
+	PreUpdateCmd          string `json:"pre_update_cmd,omitempty"`
+	PostUpdateCmd         string `json:"post_update_cmd,omitempty"`
+	RollbackOnHookFailure bool   `json:"rollback_on_hook_failure,omitempty"`
+	AllowSingleFile       bool   `json:"allow_single_file,omitempty"`
+	Swap                  bool   `json:"swap,omitempty"`
+	AutoWrapBundle        bool   `json:"auto_wrap_bundle,omitempty"`
+	FailFast              bool   `json:"fail_fast,omitempty"`
+	RequireWritable       bool   `json:"require_writable,omitempty"`
+	Delta                 bool   `json:"delta,omitempty"`
+	BackupDir             string `json:"backup_dir,omitempty"`
+	TmpDir                string `json:"tmp_dir,omitempty"`
+	BackupMode            string `json:"backup_mode,omitempty"`
+	MinFreeBytes          int64  `json:"min_free_bytes,omitempty"`
+	NoLaunch              bool   `json:"no_launch,omitempty"`
+	AllowSelfUpdate       bool   `json:"allow_self_update,omitempty"`
+
+	HealthCheckTimeout  int `json:"health_check_timeout,omitempty"`
+	LaunchVerifySeconds int `json:"launch_verify_seconds,omitempty"`
+	WatchdogTimeout     int `json:"watchdog_timeout,omitempty"`
+
+	ProgressFD   int    `json:"progress_fd,omitempty"`
+	ProgressFile string `json:"progress_file,omitempty"`
+
+	KeepBackup bool `json:"keep_backup,omitempty"`
+	MaxBackups int  `json:"max_backups,omitempty"`
+
+	RetryAttempts  int `json:"retry_attempts,omitempty"`
+	RetryBackoffMS int `json:"retry_backoff_ms,omitempty"`
+
+	Quiet     bool   `json:"quiet,omitempty"`
+	Silent    bool   `json:"silent,omitempty"`
+	LogLevel  string `json:"log_level,omitempty"`
+	LogFormat string `json:"log_format,omitempty"`
+	LogFile   string `json:"log_file,omitempty"`
+	NoLogFile bool   `json:"no_log_file,omitempty"`
+	AppendLog bool   `json:"append_log,omitempty"`
+}
+
+// Progress tracks the progress of directory operations
+type Progress struct {
+	CurrentFile    string `json:"current_file"`
+	TotalFiles     int    `json:"total"`
+	Processed      int    `json:"processed"`
+	TotalBytes     int64  `json:"total_bytes"`
+	ProcessedBytes int64  `json:"processed_bytes"`
+	ETASeconds     *int   `json:"eta_seconds,omitempty"` // nil until throughput stabilizes
+}
+
+// verboseLogging enables debug-level log output
+var verboseLogging bool
+
+// logTransferDecision logs device/inode details behind a rename-or-copy decision
+func logTransferDecision(src, dst, decision string) {
+	if !verboseLogging {
+		return
+	}
+
+	srcDev, srcIno, err := fileIdentity(src)
+	if err != nil {
+		debugf("Transfer %s -> %s: %s (source identity unavailable: %v)", src, dst, decision, err)
+		return
+	}
+	dstDev, dstIno, err := fileIdentity(dst)
+	if err != nil {
+		debugf("Transfer %s -> %s: %s (destination identity unavailable: %v)", src, dst, decision, err)
+		return
+	}
+
+	debugf("Transfer %s (dev=%d ino=%d) -> %s (dev=%d ino=%d): %s",
+		src, srcDev, srcIno, dst, dstDev, dstIno, decision)
+}
+
+// backupTransferDecision describes how files get from currentPath into backupDir
+func backupTransferDecision(currentPath, backupDir string) string {
+	if backupEntryName(currentPath, backupDir) != "" {
+		return "rename (backup lives inside the current directory)"
+	}
+	return "rename, or copy per file if --backup-dir or --tmp-dir is on another filesystem"
+}
+
+// generateTempFilename creates a unique temporary filename
+func generateTempFilename(originalPath, suffix string) string {
+	timestamp := strconv.FormatInt(time.Now().UnixNano(), 16)
+	return fmt.Sprintf("%s.%s.%s", originalPath, suffix, timestamp[:8])
+}
+
+// tempDir is the --tmp-dir intermediate copies are made in, "" to make them beside their target
+var tempDir string
+
+// tempDirPath moves path, an intermediate copy beside its target, into --tmp-dir
+// when one is set. A copy that must be renamed into place (or from it) stays beside
+// its target when --tmp-dir is on another filesystem, since the rename would turn
+// into a copy and the replacement would no longer be atomic.
+func tempDirPath(path string, renamed bool) string {
+	if tempDir == "" {
+		return path
+	}
+	if renamed {
+		tempDev, _, err := fileIdentity(tempDir)
+		targetDev, _, targetErr := fileIdentity(filepath.Dir(path))
+		if err != nil || targetErr != nil || tempDev != targetDev {
+			debugf("--tmp-dir is on another filesystem than %s, keeping %s beside it", filepath.Dir(path), filepath.Base(path))
+			return path
+		}
+	}
+	return filepath.Join(tempDir, filepath.Base(path))
+}
+
+// newBackupDir returns a new backup directory for replacing currentPath: a hidden
+// subdirectory of currentPath, or a directory under --backup-dir, else --tmp-dir,
+// when one is set
+func newBackupDir(currentPath string, config *UpdateConfig) string {
+	root := config.BackupDir
+	if root == "" {
+		root = config.TmpDir
+	}
+	if root == "" {
+		return filepath.Join(currentPath, generateTempFilename("", "backup"))
+	}
+	return filepath.Join(root, filepath.Base(currentPath)+generateTempFilename("", "backup"))
+}
+
+// defaultBackupMode is the permission of a backup root when --backup-mode is not given
+const defaultBackupMode fs.FileMode = 0700
+
+// backupMode returns the permission of the backup root: --backup-mode, or owner-only
+// so files the current version kept private stay private while they sit in the backup
+func backupMode(config *UpdateConfig) fs.FileMode {
+	if config.BackupMode == "" {
+		return defaultBackupMode
+	}
+	mode, _ := strconv.ParseUint(config.BackupMode, 8, 32) // Validated by normalize
+	return fs.FileMode(mode)
+}
+
+// createBackupDir creates the backup root with the --backup-mode permission. Parent
+// directories, such as a missing --backup-dir, get the usual 0755. The mode is set
+// explicitly because the umask would otherwise mask it.
+func createBackupDir(backupDir string, config *UpdateConfig) error {
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return err
+	}
+	return os.Chmod(backupDir, backupMode(config))
+}
+
+// isPathWithin reports whether path is root or lies below it
+func isPathWithin(path, root string) bool {
+	relPath, err := filepath.Rel(root, path)
+	return err == nil && relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator))
+}
+
+// backupEntryName returns the name of backupDir inside currentPath, which moves and
+// clears must skip, or "" when the backup lives elsewhere
+func backupEntryName(currentPath, backupDir string) string {
+	if filepath.Dir(backupDir) != filepath.Clean(currentPath) {
+		return ""
+	}
+	return filepath.Base(backupDir)
+}
+
+// checkDistinctPaths fails if currentPath and newPath, with symlinks resolved, are
+// the same file or directory or one lies inside the other
+func checkDistinctPaths(currentPath, newPath string) error {
+	resolvedCurrent, resolvedNew := currentPath, newPath
+	if resolved, err := filepath.EvalSymlinks(currentPath); err == nil {
+		resolvedCurrent = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(newPath); err == nil {
+		resolvedNew = resolved
+	}
+
+	currentInfo, currentErr := os.Stat(resolvedCurrent)
+	newInfo, newErr := os.Stat(resolvedNew)
+	switch {
+	case resolvedCurrent == resolvedNew, currentErr == nil && newErr == nil && os.SameFile(currentInfo, newInfo):
+		return fmt.Errorf("current and new paths are the same: %s", resolvedCurrent)
+	case isPathWithin(resolvedNew, resolvedCurrent):
+		return fmt.Errorf("new path %s is inside the current path %s", resolvedNew, resolvedCurrent)
+	case isPathWithin(resolvedCurrent, resolvedNew):
+		return fmt.Errorf("current path %s is inside the new path %s", resolvedCurrent, resolvedNew)
+	}
+	return nil
+}
+
+// typeToString converts ApplicationType to human-readable string
+func typeToString(appType ApplicationType) string {
+	switch appType {
+	case SingleFile:
+		return "single file"
+	case MacAppBundle:
+		return "macOS app bundle (not supported)"
+	case MacAppBundleDirectory:
+		return "macOS app bundle directory"
+	case MacDirectory:
+		return "macOS directory"
+	case WindowsAppDirectory:
+		return "Windows directory"
+	case LinuxAppDirectory:
+		return "Linux directory"
+	case GenericDirectory:
+		return "generic directory"
+	case LinuxAppImage:
+		return "Linux AppImage"
+	default:
+		return "unknown"
+	}
+}
+
+// areTypesCompatible checks if two application types can be updated from one to another
+func areTypesCompatible(currentType, newType ApplicationType) bool {
+	// Single file to single file is always compatible, AppImages included
+	if isFileType(currentType) && isFileType(newType) {
+		return true
+	}
+
+	// Any directory type to any other directory type is compatible
+	// This allows updating between different platform-specific directory types
+	if !isFileType(currentType) && !isFileType(newType) {
+		return true
+	}
+
+	// Single file to directory or vice versa is not compatible
+	return false
+}
+
+// DetectApplicationType determines the type of application based on file system analysis
+func DetectApplicationType(appPath string) (ApplicationType, error) {
+	info, err := os.Stat(appPath)
+	if err != nil {
+		return SingleFile, fmt.Errorf("failed to stat path %s: %w", appPath, err)
+	}
+
+	// Check if it's a single file
+	if isAppImage(appPath, info) {
+		return LinuxAppImage, nil
+	}
+	if !info.IsDir() {
+		return SingleFile, nil
+	}
+
+	// On macOS, treat .app bundles as single files, not directories
+	if runtime.GOOS == "darwin" && strings.HasSuffix(appPath, ".app") {
+		return MacAppBundle, nil
+	}
+
+	// It's a regular directory, analyze its contents
+	switch runtime.GOOS {
+	case "darwin":
+		return detectMacDirectory(appPath)
+	case "windows":
+		return detectWindowsApp(appPath)
+	default: // linux and others
+		return detectLinuxApp(appPath)
+	}
+}
+
+// containsAppBundles checks if a directory contains .app bundles
+func containsAppBundles(dirPath string) (bool, error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return false, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasSuffix(entry.Name(), ".app") {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// detectMacDirectory detects macOS directory applications (non-bundle)
+func detectMacDirectory(appPath string) (ApplicationType, error) {
+	// First check if this directory contains .app bundles
+	hasAppBundles, err := containsAppBundles(appPath)
+	if err == nil && hasAppBundles {
+		return MacAppBundleDirectory, nil
+	}
+
+	// Check if it's a regular directory with executables
+	// On macOS, just search the directory itself
+	executables, err := findExecutablesInDirectory(appPath, "")
+	if err == nil && len(executables) > 0 {
+		return MacDirectory, nil
+	}
+
+	return GenericDirectory, nil
+}
+
+// detectWindowsApp detects Windows application types
+func detectWindowsApp(appPath string) (ApplicationType, error) {
+	// Look for .exe files in the directory
+	exeFiles, err := findExecutablesInDirectory(appPath, ".exe")
+	if err != nil {
+		return GenericDirectory, err
+	}
+
+	if len(exeFiles) > 0 {
+		return WindowsAppDirectory, nil
+	}
+
+	return GenericDirectory, nil
+}
+
+// detectLinuxApp detects Linux application types
+func detectLinuxApp(appPath string) (ApplicationType, error) {
+	// Look for executable files in common locations
+	locations := []string{
+		filepath.Join(appPath, "bin"),
+		filepath.Join(appPath, "usr", "bin"),
+		appPath,
+	}
+
+	for _, location := range locations {
+		if _, err := os.Stat(location); err == nil {
+			executables, err := findExecutablesInDirectory(location, "")
+			if err == nil && len(executables) > 0 {
+				return LinuxAppDirectory, nil
+			}
+		}
+	}
+
+	return GenericDirectory, nil
+}
+
+// executableSearchDepth limits how many directory levels executable search descends (0 = unlimited)
+var executableSearchDepth int
+
+// pathDepth returns the number of components in a relative path ("." has depth 0)
+func pathDepth(relPath string) int {
+	if relPath == "." {
+		return 0
+	}
+	return strings.Count(filepath.ToSlash(relPath), "/") + 1
+}
+
+// findExecutablesInDirectory finds executable files in a directory, shallowest first
+func findExecutablesInDirectory(dir, extension string) ([]string, error) {
+	var executables []string
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip files with permission errors
+		}
+
+		if path != dir && len(ignorePatterns) > 0 {
+			if relPath, _ := filepath.Rel(dir, path); matchesAnyPattern(relPath, ignorePatterns) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		if d.IsDir() {
+			// Never launch the previous version from a backup kept for the health check
+			if path != dir && isUpdaterArtifact(d.Name()) {
+				return filepath.SkipDir
+			}
+
+			// On macOS, treat .app directories as executable
+			if runtime.GOOS == "darwin" && strings.HasSuffix(path, ".app") {
+				relPath, _ := filepath.Rel(dir, path)
+				executables = append(executables, relPath)
+				return nil
+			}
+
+			// Don't descend below the configured search depth
+			if executableSearchDepth > 0 {
+				relPath, _ := filepath.Rel(dir, path)
+				if pathDepth(relPath) >= executableSearchDepth {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+
+		// Check if file has executable extension or no extension (Linux)
+		if extension != "" && !strings.HasSuffix(strings.ToLower(path), extension) {
+			return nil
+		}
+
+		// Check if file is executable
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		if isExecutable(info) {
+			relPath, _ := filepath.Rel(dir, path)
+			executables = append(executables, relPath)
+		}
+
+		return nil
+	})
+
+	sortByDepth(executables)
+	return executables, err
+}
+
+// isExecutable checks if a file is executable
+func isExecutable(info fs.FileInfo) bool {
+	// Check Unix executable permissions
+	if runtime.GOOS != "windows" {
+		return info.Mode().Perm()&0111 != 0
+	}
+
+	// On Windows, check file extensions
+	ext := strings.ToLower(filepath.Ext(info.Name()))
+	executableExts := []string{".exe", ".com", ".bat", ".cmd"}
+	for _, exeExt := range executableExts {
+		if ext == exeExt {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findExecutableInDirectory finds the best executable to launch: the first of
+// preferredNames that matches one, else the CFBundleExecutable of a bundle-structured
+// macOS directory, else the first one found
+func findExecutableInDirectory(appPath string, preferredNames []string) (string, error) {
+	appType, err := DetectApplicationType(appPath)
+	if err != nil {
+		return "", err
+	}
+
+	var searchDirs []string
+	var extension string
+
+	switch appType {
+	case MacDirectory:
+		// On macOS, just search the directory itself
+		searchDirs = []string{appPath}
+		extension = ""
+	case WindowsAppDirectory:
+		searchDirs = []string{appPath}
+		extension = ".exe"
+	case LinuxAppDirectory:
+		searchDirs = []string{appPath}
+		extension = ""
+	default:
+		return "", fmt.Errorf("unsupported app type for executable detection: %v", appType)
+	}
+
+	// Search through all possible directories
+	for _, searchDir := range searchDirs {
+		if _, err := os.Stat(searchDir); err != nil {
+			continue // Directory doesn't exist, try next one
+		}
+
+		// A bundle-structured directory names its launch target in Info.plist
+		var bundleExe string
+		if appType == MacDirectory {
+			var plistErr error
+			if bundleExe, plistErr = bundleExecutable(searchDir); plistErr != nil {
+				debugf("No bundle executable in %s: %v", searchDir, plistErr)
+			}
+		}
+
+		executables, err := findExecutablesInDirectory(searchDir, extension)
+		if err != nil || len(executables) == 0 {
+			if bundleExe != "" {
+				return bundleExe, nil
+			}
+			continue // No executables found, try next directory
+		}
+
+		// Preferred names are tried in order, so an earlier one wins over a later one
+		for _, preferredName := range preferredNames {
+			for _, exe := range executables {
+				if matchesAppName(exe, []string{preferredName}) {
+					return filepath.Join(searchDir, exe), nil
+				}
+			}
+		}
+
+		if bundleExe != "" {
+			return bundleExe, nil
+		}
+
+		// Fall back to the first executable that looks like the application
+		return filepath.Join(searchDir, firstLaunchCandidate(executables)), nil
+	}
+
+	return "", fmt.Errorf("no executables found in any search directories")
+}
+
+// verifyLaunchable checks that newPath holds something launchApplication can start
+// and, when an app name is configured, that an executable of that name is among it.
+// Files that --make-executable will mark executable after the copy count as executables.
+func verifyLaunchable(newPath string, config *UpdateConfig) error {
+	appType, err := DetectApplicationType(newPath)
+	if err != nil {
+		return err
+	}
+
+	switch appType {
+	case SingleFile, LinuxAppImage:
+		info, err := os.Stat(newPath)
+		if err != nil {
+			return err
+		}
+		if !isExecutable(info) && len(config.MakeExecutable) == 0 {
+			return fmt.Errorf("%s is not executable", newPath)
+		}
+		return nil
+
+	case MacDirectory, WindowsAppDirectory, LinuxAppDirectory, GenericDirectory:
+		appNames := appNameCandidates(config.AppName)
+		exe, err := findExecutableInDirectory(newPath, appNames)
+		if err == nil && (len(appNames) == 0 || matchesAppName(exe, appNames)) {
+			debugf("New version will launch %s", exe)
+			return nil
+		}
+		if found, _ := findMarkedExecutable(newPath, config.MakeExecutable, appNames); found {
+			return nil
+		}
+		if len(appNames) > 0 {
+			return fmt.Errorf("no executable named '%s' in %s", strings.Join(appNames, "' or '"), newPath)
+		}
+		return fmt.Errorf("no executable found in %s", newPath)
+
+	default:
+		// .app bundle directories always hold a bundle to open
+		return nil
+	}
+}
+
+// appNameCandidates splits an --app-name value, a comma-separated list of
+// executable names in order of preference, into its names
+func appNameCandidates(appName string) []string {
+	var names []string
+	for _, name := range strings.Split(appName, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// matchesAppName reports whether the executable at path is called one of appNames,
+// ignoring case, any extension of the executable such as .exe or .app, and an .exe
+// in the name so that one list serves every platform
+func matchesAppName(path string, appNames []string) bool {
+	name := strings.ToLower(filepath.Base(path))
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	for _, appName := range appNames {
+		appName = strings.ToLower(appName)
+		if name == appName || stem == appName || stem == strings.TrimSuffix(appName, ".exe") {
+			return true
+		}
+	}
+	return false
+}
+
+// findMarkedExecutable reports whether root holds a file matching one of the
+// --make-executable patterns, and named one of appNames when any are given
+func findMarkedExecutable(root string, patterns []string, appNames []string) (bool, error) {
+	if len(patterns) == 0 {
+		return false, nil
+	}
+
+	found := false
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || found || d.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if matchesAnyPattern(relPath, patterns) && (len(appNames) == 0 || matchesAppName(path, appNames)) {
+			found = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return found, err
+}
+
+// bundleExecutable returns the executable that dir's Contents/Info.plist names as
+// CFBundleExecutable, which lives in Contents/MacOS
+func bundleExecutable(dir string) (string, error) {
+	name, err := readPlistString(filepath.Join(dir, "Contents", "Info.plist"), "CFBundleExecutable")
+	if err != nil {
+		return "", err
+	}
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid CFBundleExecutable %q", name)
+	}
+
+	exePath := filepath.Join(dir, "Contents", "MacOS", name)
+	info, err := os.Stat(exePath)
+	if err != nil {
+		return "", err
+	}
+	if !isExecutable(info) {
+		return "", fmt.Errorf("%s is not executable", exePath)
+	}
+	return exePath, nil
+}
+
+// processPollInterval is how often a waited-for process is checked for liveness
+const processPollInterval = 200 * time.Millisecond
+
+// ErrWaitTimeout is returned when a waited-for process is still running after the timeout
+var ErrWaitTimeout = errors.New("timed out waiting for process to exit")
+
+// waitForProcessExit waits for the specified PID to exit, however long that takes
+func waitForProcessExit(pid int) error {
+	return waitForProcessExitWithTimeout(context.Background(), pid, 0)
+}
+
+// waitForProcessExitWithTimeout waits for the specified PID to exit, returning
+// ErrWaitTimeout if it is still running after timeout (0 waits forever), or the
+// context's error if ctx is cancelled first
+func waitForProcessExitWithTimeout(ctx context.Context, pid int, timeout time.Duration) error {
+	if !isProcessAlive(pid) {
+		infof("Process %d not found, assuming it already exited", pid)
+		return nil // Process doesn't exist, which is fine
+	}
+
+	if !pollForProcessExit(ctx, pid, timeout) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("process %d did not exit within %v: %w", pid, timeout, ErrWaitTimeout)
+	}
+	infof("Process %d exited", pid)
+	return nil
+}
+
+// Policies for a process that outlives the wait timeout
+const (
+	timeoutActionProceed   = "proceed"   // update anyway
+	timeoutActionAbort     = "abort"     // give up without touching the installation
+	timeoutActionKill      = "kill"      // force-kill the process, then update
+	timeoutActionTerminate = "terminate" // ask it to shut down, force-kill it if it does not, then update
+)
+
+// applyTimeoutAction handles a wait timeout according to --timeout-action.
+// A non-nil return means the update must not go ahead.
+func applyTimeoutAction(ctx context.Context, pid int, config *UpdateConfig, waitErr error) error {
+	action := config.TimeoutAction
+	switch action {
+	case timeoutActionAbort:
+		infof("Timeout action '%s': giving up on the update", action)
+		return waitErr
+
+	case timeoutActionKill:
+		infof("Timeout action '%s': force-killing process %d", action, pid)
+		if err := killProcess(pid); err != nil {
+			return err
+		}
+		if !pollForProcessExit(ctx, pid, defaultShutdownTimeout) {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return fmt.Errorf("process %d is still running after being killed", pid)
+		}
+		infof("Process %d killed, continuing with update", pid)
+		return nil
+
+	case timeoutActionTerminate:
+		infof("Timeout action '%s': asking process %d to shut down", action, pid)
+		return requestProcessShutdown(ctx, pid, config, true)
+
+	default:
+		warnf("%v", waitErr)
+		infof("Timeout action '%s': continuing with update anyway...", timeoutActionProceed)
+		return nil
+	}
+}
+
+// waitForTargetProcesses waits for the PID and every process named
+// --wait-process-name to exit. The name is looked up again once they are gone,
+// so an instance started meanwhile, or one that relaunched under a new PID, is
+// waited for too. --timeout applies to each process.
+func waitForTargetProcesses(ctx context.Context, config *UpdateConfig) error {
+	waited := make(map[int]bool)
+	var pending []int
+	if config.PID > 0 {
+		pending = append(pending, config.PID)
+	}
+
+	for {
+		if config.WaitProcessName != "" {
+			pids, err := findProcessesByName(config.WaitProcessName)
+			if err != nil {
+				return fmt.Errorf("failed to list processes named %s: %w", config.WaitProcessName, err)
+			}
+			for _, pid := range pids {
+				if !waited[pid] {
+					pending = append(pending, pid)
+				}
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+
+		for _, pid := range pending {
+			waited[pid] = true
+			if err := waitForTargetProcess(ctx, pid, config); err != nil {
+				return err
+			}
+		}
+		if config.WaitProcessName == "" {
+			return nil
+		}
+		pending = pending[:0]
+	}
+}
+
+// waitForTargetProcess waits for pid to exit, asking it to shut down first with
+// --graceful-shutdown and applying --timeout-action if it outlives --timeout
+func waitForTargetProcess(ctx context.Context, pid int, config *UpdateConfig) error {
+	if config.GracefulShutdown {
+		if err := requestProcessShutdown(ctx, pid, config, config.ForceKill); err != nil {
+			warnf("Graceful shutdown failed: %v", err)
+		}
+	}
+
+	infof("Waiting for process %d to exit...", pid)
+	timeout := time.Duration(config.Timeout) * time.Second
+	err := waitForProcessExitWithTimeout(ctx, pid, timeout)
+	if errors.Is(err, ErrWaitTimeout) {
+		infof("Timed out after %v waiting for process %d", timeout, pid)
+		err = applyTimeoutAction(ctx, pid, config, err)
+		if err != nil && ctx.Err() == nil {
+			return withExitCode(timeoutExitCode(config), fmt.Errorf("update aborted: %w", err))
+		}
+	}
+	if ctx.Err() != nil {
+		return withExitCode(ExitCancelled, fmt.Errorf("update cancelled while waiting for process %d: %w", pid, ctx.Err()))
+	} else if err != nil {
+		warnf("Failed to wait for process exit: %v", err)
+		infof("Continuing with update anyway...")
+	}
+	return nil
+}
+
+// timeoutExitCode is the exit code for an update given up on because the process
+// outlived --timeout
+func timeoutExitCode(config *UpdateConfig) int {
+	if config.TimeoutExitCode > 0 {
+		return config.TimeoutExitCode
+	}
+	return ExitWaitTimeout
+}
+
+// killProcess force-kills pid
+func killProcess(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return fmt.Errorf("failed to find process %d: %v", pid, err)
+	}
+	if err := process.Kill(); err != nil {
+		return fmt.Errorf("failed to kill process %d: %v", pid, err)
+	}
+	process.Wait() // Reaps it if it is our own child (the relaunched app), otherwise returns at once
+	return nil
+}
+
+// pollForProcessExit waits until pid is gone, giving up after timeout (0 waits forever)
+// or when ctx is cancelled. It reports whether the process exited. Where the platform
+// can wait on the process itself (Windows) it does so; otherwise, or if that fails, it polls.
+func pollForProcessExit(ctx context.Context, pid int, timeout time.Duration) bool {
+	if exited, ok := waitForProcessHandle(ctx, pid, timeout); ok {
+		return exited
+	}
+
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+
+	for isProcessAlive(pid) {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(processPollInterval):
+		}
+	}
+	return true
+}
+
+// defaultShutdownTimeout is how long a process may take to honor a shutdown request
+const defaultShutdownTimeout = 10 * time.Second
+
+// requestProcessShutdown asks pid to quit and waits for it, force-killing it if
+// forceKill is set and it has not exited after --shutdown-timeout
+func requestProcessShutdown(ctx context.Context, pid int, config *UpdateConfig, forceKill bool) error {
+	signal := config.ShutdownSignal
+	if signal == "" {
+		signal = defaultShutdownSignal
+	}
+
+	timeout := defaultShutdownTimeout
+	if config.ShutdownTimeout > 0 {
+		timeout = time.Duration(config.ShutdownTimeout) * time.Second
+	}
+
+	infof("Requesting process %d to shut down (%s)", pid, signal)
+	if err := sendShutdownRequest(pid, signal); err != nil {
+		if !forceKill {
+			return err
+		}
+		warnf("Shutdown request failed: %v", err)
+	} else if pollForProcessExit(ctx, pid, timeout) {
+		infof("Process %d shut down gracefully", pid)
+		return nil
+	} else if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if !forceKill {
+		return fmt.Errorf("process %d did not exit within %v", pid, timeout)
+	}
+
+	infof("Process %d did not shut down in time, force-killing", pid)
+	return killProcess(pid)
+}
+
+// copyFile copies a file from src to dst
+func copyFile(src, dst string) error {
+	return copyFileHashed(src, dst, nil)
+}
+
+// copyFileHashed copies a file from src to dst, feeding the content into hash
+// (when not nil) as it is read so the copy can be verified in the same pass
+func copyFileHashed(src, dst string, hash hash.Hash) error {
+	sourceFile, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open source file %s: %v", src, err)
+	}
+	defer sourceFile.Close()
+
+	srcInfo, err := sourceFile.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat source file %s: %v", src, err)
+	}
+
+	// Create destination directory if it doesn't exist
+	destDir := filepath.Dir(dst)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return fmt.Errorf("failed to create destination directory %s: %v", destDir, err)
+	}
+
+	destinationFile, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create destination file %s: %v", dst, err)
+	}
+	defer destinationFile.Close()
+
+	// Keep the source permissions so executables stay executable
+	if err := destinationFile.Chmod(srcInfo.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to set permissions on %s: %v", dst, err)
+	}
+
+	if err := copyFileContent(destinationFile, sourceFile, hash); err != nil {
+		return fmt.Errorf("failed to copy file content: %v", err)
+	}
+
+	// Sync to ensure all data is written
+	err = destinationFile.Sync()
+	if err != nil {
+		return fmt.Errorf("failed to sync destination file: %v", err)
+	}
+
+	return nil
+}
+
+// atomicReplace performs atomic file replacement with rollback capability
+func atomicReplace(ctx context.Context, currentPath, newPath string, config *UpdateConfig) (*installBackup, error) {
+	infof("Starting atomic replacement: %s -> %s", newPath, currentPath)
+
+	// Backing up the current version would also empty or swallow the source
+	if err := checkDistinctPaths(currentPath, newPath); err != nil {
+		return nil, withExitCode(ExitBadArgs, err)
+	}
+
+	// Detect application types
+	currentType, err := DetectApplicationType(currentPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect current app type: %w", err)
+	}
+
+	newType, err := DetectApplicationType(newPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect new app type: %w", err)
+	}
+
+	// Validate type compatibility
+	typeChange := !areTypesCompatible(currentType, newType)
+	if typeChange && !config.Force {
+		return nil, withExitCode(ExitIncompatible, fmt.Errorf("%w: current=%v (%s), new=%v (%s). Both must be either files or directories (--force overrides this)",
+			ErrIncompatibleTypes, currentType, typeToString(currentType), newType, typeToString(newType)))
+	}
+	if typeChange {
+		warnf("*** --force: replacing the %s %s with the %s %s. The installation changes layout; "+
+			"anything that refers to paths inside it may need updating ***",
+			typeToString(currentType), currentPath, typeToString(newType), newPath)
+	}
+
+	runSummary.update(func(sum *updateSummary) { sum.AppType = typeToString(currentType) })
+
+	// Refuse structurally broken release artifacts before touching anything
+	if err := verifyRequiredPaths(newPath, config.RequirePaths); err != nil {
+		return nil, fmt.Errorf("new version failed structure check: %w", err)
+	}
+
+	// Replacing an app with a different app is almost always a release pipeline mistake
+	if err := checkAppIdentity(currentPath, newPath, config.AppName, config.StrictIdentity); err != nil {
+		return nil, withExitCode(ExitIncompatible, err)
+	}
+
+	// A misconfigured release channel must not replace a newer build with an older one
+	if config.CompareVersions {
+		if err := checkVersionUpgrade(currentPath, newPath, config.AllowDowngrade); err != nil {
+			return nil, withExitCode(ExitIncompatible, err)
+		}
+	}
+
+	// A release without anything to launch would only be noticed after the old version is gone
+	if !config.NoLaunch {
+		if err := verifyLaunchable(newPath, config); err != nil {
+			return nil, fmt.Errorf("new version cannot be launched: %w", err)
+		}
+	}
+
+	// Refuse a corrupted or tampered download before touching the current installation
+	if config.VerifyChecksum {
+		infof("Verifying checksums of %s", newPath)
+		if err := verifyNewVersion(newPath, config); err != nil {
+			return nil, fmt.Errorf("new version failed checksum verification: %w", err)
+		}
+	}
+
+	// Refuse an unsigned or tampered release before touching the current installation
+	if config.VerifySignature {
+		if err := verifyNewVersionSignature(newPath, config); err != nil {
+			return nil, fmt.Errorf("new version failed signature verification: %w", err)
+		}
+	}
+
+	// Catch truncated or unreadable sources before they replace a working install
+	if config.VerifySourceReadable {
+		infof("Verifying that every file in %s is readable", newPath)
+		if err := verifySourceReadable(newPath); err != nil {
+			return nil, fmt.Errorf("new version failed readability check: %w", err)
+		}
+	}
+
+	// A protected install location would otherwise fail with "permission denied" halfway through
+	if err := checkWritable(currentPath, config); err != nil {
+		if config.RequireWritable {
+			return nil, withExitCode(ExitBadArgs, err)
+		}
+		warnf("%v", err)
+	}
+
+	// Let the caller veto the update, for example while a critical task is running
+	if config.PreUpdateCmd != "" {
+		env := hookEnv(config, "", readAppVersion(currentPath), readAppVersion(newPath))
+		if err := runHook(ctx, "pre-update", config.PreUpdateCmd, hookDir(currentPath), env); err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			return nil, withExitCode(ExitVetoed, fmt.Errorf("update vetoed: %w", err))
+		}
+	}
+
+	// Stop here in dry-run mode: every check passed, so report what would change
+	if config.DryRun && typeChange {
+		infof("Update plan (forced type change): replace the %s %s with the %s %s",
+			typeToString(currentType), currentPath, typeToString(newType), newPath)
+		return nil, nil
+	}
+	if config.DryRun && isFileType(currentType) {
+		infof("Update plan (single file): replace %s with %s", currentPath, newPath)
+		return nil, nil
+	}
+	if config.DryRun {
+		plan, err := planDirectoryReplace(currentPath, newPath, config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to plan update: %w", err)
+		}
+		logPlan(plan, true)
+		if err := checkFreeSpace(currentPath, plan.bytesToCopy(), config.MinFreeBytes); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	// Last chance to give up while the current version is still untouched
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// A previous --harden run may have left read-only or immutable files behind
+	if !isFileType(currentType) {
+		if err := unhardenInstallation(currentPath); err != nil {
+			return nil, fmt.Errorf("failed to revert hardening of current version: %w", err)
+		}
+	}
+
+	if typeChange {
+		return atomicTypeChangeReplace(ctx, currentPath, newPath, currentType, config)
+	}
+
+	// Handle different application types
+	switch currentType {
+	case SingleFile, LinuxAppImage:
+		if currentType == SingleFile && !config.AllowSingleFile {
+			return nil, fmt.Errorf("single file applications are not supported - use directory-based updates or --allow-single-file")
+		}
+		newInfo, err := os.Stat(newPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkFreeSpace(filepath.Dir(currentPath), newInfo.Size(), config.MinFreeBytes); err != nil {
+			return nil, err
+		}
+		return atomicFileReplace(currentPath, newPath)
+	case MacAppBundle:
+		return nil, fmt.Errorf("direct .app bundle arguments are not supported - use directory containing .app bundles")
+	case MacAppBundleDirectory, MacDirectory, WindowsAppDirectory, LinuxAppDirectory, GenericDirectory:
+		return atomicDirectoryReplace(ctx, currentPath, newPath, config)
+	default:
+		return nil, fmt.Errorf("unsupported application type: %v", currentType)
+	}
+}
+
+// atomicFileReplace performs atomic file replacement. The previous version is
+// returned as the backup, renamed next to currentPath.
+func atomicFileReplace(currentPath, newPath string) (*installBackup, error) {
+	infof("Starting atomic file replacement: %s -> %s", newPath, currentPath)
+
+	// Generate unique temporary filenames. The previous version may be moved to
+	// --tmp-dir by copying it, but the new one must be renamed into place.
+	tempFile := tempDirPath(generateTempFilename(currentPath, "tmp"), false)
+	newFile := tempDirPath(generateTempFilename(currentPath, "new"), true)
+
+	// Step 1: Move current version to temp file (backup)
+	infof("Step 1: Backing up current version to %s", tempFile)
+	if err := renameOrCopy(currentPath, tempFile); err != nil {
+		return nil, fmt.Errorf("failed to backup current version: %v", err)
+	}
+
+	// Step 2: Copy new version to intermediate file
+	infof("Step 2: Copying new version to %s", newFile)
+	if err := copyFileRetrying(newPath, newFile); err != nil {
+		// Rollback: restore from temp file
+		warnf("Failed to copy new version, rolling back: %v", err)
+		if rollbackErr := renameOrCopy(tempFile, currentPath); rollbackErr != nil {
+			errorf("Rollback failed: %v", rollbackErr)
+			err = withRollbackFailure(err, rollbackErr)
+		} else {
+			runSummary.recordRollback()
+		}
+		return nil, fmt.Errorf("failed to copy new version: %w", err)
+	}
+	if info, err := os.Stat(newFile); err == nil {
+		runSummary.recordCopy(1, info.Size())
+	}
+
+	// Step 3: Atomic move to final location
+	infof("Step 3: Moving to final location %s", currentPath)
+	if err := renameOrCopy(newFile, currentPath); err != nil {
+		// Rollback: restore from temp file
+		warnf("Failed to move to final location, rolling back: %v", err)
+		if rollbackErr := renameOrCopy(tempFile, currentPath); rollbackErr != nil {
+			errorf("Rollback failed: %v", rollbackErr)
+			err = withRollbackFailure(err, rollbackErr)
+		} else {
+			runSummary.recordRollback()
+		}
+		// Clean up the intermediate file
+		os.Remove(newFile)
+		return nil, fmt.Errorf("failed to move to final location: %w", err)
+	}
+
+	syncDirLogged(filepath.Dir(currentPath))
+	infof("Atomic file replacement completed successfully")
+	return &installBackup{
+		dir: tempFile,
+		rollback: func() error {
+			// Renaming over the new version puts the previous one back in a single step
+			return renameOrCopy(tempFile, currentPath)
+		},
+	}, nil
+}
+
+// atomicAppBundleDirectoryReplace performs atomic replacement for directories containing .app bundles
+func atomicAppBundleDirectoryReplace(ctx context.Context, currentPath, newPath string, config *UpdateConfig) (*installBackup, error) {
+	infof("Starting atomic app bundle directory replacement: %s -> %s", newPath, currentPath)
+
+	// Generate unique temporary backup directory name
+	tempBackupDir := newBackupDir(currentPath, config)
+
+	// Record what the backup must contain
+	beforeFiles, beforeBytes, err := measureReplaceable(currentPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure current directory: %v", err)
+	}
+
+	opts, err := newCopyOptions(ctx, newPath, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 1: Create temp backup directory inside current directory
+	infof("Step 1: Creating backup directory %s", tempBackupDir)
+	if err := createBackupDir(tempBackupDir, config); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %v", err)
+	}
+	journal := startJournal(currentPath, newPath, tempBackupDir, true, config)
+
+	// Step 2: Move all current files to backup directory, treating .app bundles as atomic files
+	infof("Step 2: Moving current files to backup")
+	logTransferDecision(currentPath, tempBackupDir, backupTransferDecision(currentPath, tempBackupDir))
+	if err := moveAppBundleDirectoryContents(currentPath, tempBackupDir); err != nil {
+		// Rollback: move back whatever was already moved
+		warnf("Failed to move files to backup, restoring: %v", err)
+		if rollbackErr := restoreAbortedBackup(currentPath, tempBackupDir, restoreAppBundleDirectoryBackup, journal); rollbackErr != nil {
+			err = withRollbackFailure(err, rollbackErr)
+		}
+		return nil, fmt.Errorf("failed to backup current files: %w", err)
+	}
+
+	// Step 2b: Make sure everything arrived in the backup before overwriting anything
+	err = verifyBackupComplete(currentPath, tempBackupDir, beforeFiles, beforeBytes)
+	if err == nil {
+		err = injectFailure(phaseBackup)
+	}
+	if err != nil {
+		warnf("Backup is incomplete, restoring: %v", err)
+		if rollbackErr := restoreAbortedBackup(currentPath, tempBackupDir, restoreAppBundleDirectoryBackup, journal); rollbackErr != nil {
+			err = withRollbackFailure(err, rollbackErr)
+		}
+		return nil, fmt.Errorf("backup verification failed: %w", err)
+	}
+	journal.advance(journalCopying)
+
+	// Step 3: Copy new files to current directory, treating .app bundles as atomic files
+	infof("Step 3: Copying new files to current directory")
+	logTransferDecision(newPath, currentPath, "copy (new version source is left intact)")
+	err = copyAppBundleDirectoryTree(newPath, currentPath, opts)
+	if err == nil {
+		err = injectFailure(phaseCopy)
+	}
+	if err != nil {
+		// Rollback: move files back from backup
+		warnf("Failed to copy new files, rolling back: %v", err)
+		if rollbackErr := rollbackDirectoryReplace(currentPath, tempBackupDir, restoreAppBundleDirectoryBackup, journal); rollbackErr != nil {
+			errorf("Rollback failed: %v", rollbackErr)
+			err = withRollbackFailure(err, rollbackErr)
+		} else {
+			journal.remove()
+		}
+		return nil, fmt.Errorf("failed to copy new directory: %w", err)
+	}
+
+	// Step 3b: Verify the installed structure while the backup still exists
+	err = verifyInstalledTree(currentPath, config, opts)
+	if err == nil {
+		err = injectFailure(phaseFinalize)
+	}
+	if err != nil {
+		warnf("Installed tree failed verification, rolling back: %v", err)
+		if rollbackErr := rollbackDirectoryReplace(currentPath, tempBackupDir, restoreAppBundleDirectoryBackup, journal); rollbackErr != nil {
+			errorf("Rollback failed: %v", rollbackErr)
+			err = withRollbackFailure(err, rollbackErr)
+		} else {
+			journal.remove()
+		}
+		return nil, fmt.Errorf("installed version failed verification: %w", err)
+	}
+
+	syncDirLogged(currentPath)
+	infof("Atomic app bundle directory replacement completed successfully")
+	journal.advance(journalInstalled)
+	return newInstallBackup(currentPath, tempBackupDir, restoreAppBundleDirectoryBackup, journal), nil
+}
+
+// atomicDirectoryReplace performs atomic directory replacement with robust rollback capability
+func atomicDirectoryReplace(ctx context.Context, currentPath, newPath string, config *UpdateConfig) (*installBackup, error) {
+	infof("Starting robust atomic directory replacement: %s -> %s", newPath, currentPath)
+
+	// Check if this is a directory containing .app bundles
+	currentType, err := DetectApplicationType(currentPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect current app type: %w", err)
+	}
+
+	// Work out the changes up front so the log shows what is about to happen
+	plan, err := planDirectoryReplace(currentPath, newPath, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to plan update: %w", err)
+	}
+	logPlan(plan, verboseLogging)
+
+	if err := checkFreeSpace(currentPath, plan.bytesToCopy(), config.MinFreeBytes); err != nil {
+		return nil, err
+	}
+
+	if currentType == MacAppBundleDirectory {
+		if _, _, incremental := incrementalSelectors(config); incremental {
+			warnf("incremental options are not supported for .app bundle directories, performing a full replacement")
+		}
+		if config.Swap {
+			infof("--swap does not apply to .app bundle directories, which are swapped bundle by bundle")
+		}
+		return atomicAppBundleDirectoryReplace(ctx, currentPath, newPath, config)
+	}
+
+	// Targeted updates only touch the selected files instead of replacing the whole tree
+	if plan.Mode != "full" {
+		if config.Swap {
+			infof("--swap does not apply to %s updates", plan.Mode)
+		}
+		return incrementalDirectoryReplace(ctx, currentPath, newPath, config, plan)
+	}
+
+	if config.Swap {
+		reason := swapUnsupported(currentPath, config)
+		if reason == "" {
+			return atomicSwapReplace(ctx, currentPath, newPath, config)
+		}
+		infof("Cannot swap directories (%s), replacing files individually", reason)
+	}
+
+	// Rerunning an update whose copy was interrupted picks the copy up where it stopped
+	if config.Resumable {
+		if journal := resumableJournal(currentPath, newPath); journal != nil {
+			return resumeDirectoryReplace(ctx, currentPath, newPath, config, journal)
+		}
+	}
+
+	// Generate unique temporary backup directory name
+	tempBackupDir := newBackupDir(currentPath, config)
+
+	// Record what the backup must contain
+	beforeFiles, beforeBytes, err := measureReplaceable(currentPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure current directory: %v", err)
+	}
+
+	opts, err := newCopyOptions(ctx, newPath, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 1: Create temp backup directory inside current directory
+	infof("Step 1: Creating backup directory %s", tempBackupDir)
+	if err := createBackupDir(tempBackupDir, config); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %v", err)
+	}
+	journal := startJournal(currentPath, newPath, tempBackupDir, false, config)
+
+	// Step 2: Move all current files to backup directory
+	infof("Step 2: Moving current files to backup")
+	logTransferDecision(currentPath, tempBackupDir, backupTransferDecision(currentPath, tempBackupDir))
+	if err := moveContentsToBackup(currentPath, tempBackupDir); err != nil {
+		// Rollback: move back whatever was already moved
+		warnf("Failed to move files to backup, restoring: %v", err)
+		if rollbackErr := restoreAbortedBackup(currentPath, tempBackupDir, restoreFromBackup, journal); rollbackErr != nil {
+			err = withRollbackFailure(err, rollbackErr)
+		}
+		return nil, fmt.Errorf("failed to backup current files: %w", err)
+	}
+
+	// Step 2b: Make sure everything arrived in the backup before overwriting anything
+	err = verifyBackupComplete(currentPath, tempBackupDir, beforeFiles, beforeBytes)
+	if err == nil {
+		err = injectFailure(phaseBackup)
+	}
+	if err != nil {
+		warnf("Backup is incomplete, restoring: %v", err)
+		if rollbackErr := restoreAbortedBackup(currentPath, tempBackupDir, restoreFromBackup, journal); rollbackErr != nil {
+			err = withRollbackFailure(err, rollbackErr)
+		}
+		return nil, fmt.Errorf("backup verification failed: %w", err)
+	}
+	journal.advance(journalCopying)
+	if config.Resumable {
+		journal.enableResume(opts)
+	}
+
+	// Step 3: Copy new files to current directory
+	infof("Step 3: Copying new files to current directory")
+	logTransferDecision(newPath, currentPath, "copy (new version source is left intact)")
+	return copyIntoBackedUpDirectory(currentPath, newPath, tempBackupDir, config, opts, journal)
+}
+
+// copyIntoBackedUpDirectory copies the new version into currentPath, whose previous
+// contents are in tempBackupDir, and verifies it, rolling back on failure. This is
+// the last step of a directory replacement, and all of resuming an interrupted one.
+func copyIntoBackedUpDirectory(currentPath, newPath, tempBackupDir string, config *UpdateConfig, opts *copyOptions, journal *updateJournal) (*installBackup, error) {
+	err := copyDirectoryTree(newPath, currentPath, opts)
+	if err == nil {
+		err = injectFailure(phaseCopy)
+	}
+	if err != nil {
+		// Rollback: move files back from backup
+		warnf("Failed to copy new files, rolling back: %v", err)
+		if rollbackErr := rollbackDirectoryReplace(currentPath, tempBackupDir, restoreFromBackup, journal); rollbackErr != nil {
+			errorf("Rollback failed: %v", rollbackErr)
+			err = withRollbackFailure(err, rollbackErr)
+		} else {
+			journal.remove()
+		}
+		return nil, fmt.Errorf("failed to copy new directory: %w", err)
+	}
+
+	// Step 3b: Verify the installed structure while the backup still exists
+	err = verifyInstalledTree(currentPath, config, opts)
+	if err == nil {
+		err = injectFailure(phaseFinalize)
+	}
+	if err != nil {
+		warnf("Installed tree failed verification, rolling back: %v", err)
+		if rollbackErr := rollbackDirectoryReplace(currentPath, tempBackupDir, restoreFromBackup, journal); rollbackErr != nil {
+			errorf("Rollback failed: %v", rollbackErr)
+			err = withRollbackFailure(err, rollbackErr)
+		} else {
+			journal.remove()
+		}
+		return nil, fmt.Errorf("installed version failed verification: %w", err)
+	}
+
+	syncDirLogged(currentPath)
+	infof("Robust atomic directory replacement completed successfully")
+	journal.advance(journalInstalled)
+	return newInstallBackup(currentPath, tempBackupDir, restoreFromBackup, journal), nil
+}
+
+// Update phases at which failures can be injected in failinject builds
+const (
+	phaseBackup   = "backup"
+	phaseCopy     = "copy"
+	phaseFinalize = "finalize"
+	phaseLaunch   = "launch"
+)
+
+// copyOptions controls how directory trees are copied
+type copyOptions struct {
+	ctx           context.Context   // stops the copy between files when cancelled, may be nil
+	sourceRoot    string            // root of the tree being installed, for manifest lookups
+	tracker       *progressTracker  // receives per-file progress, may be nil
+	preserveTimes bool              // carry file and directory access and modification times over
+	checksums     map[string]string // expected SHA256 by relative path, verified while copying
+	concurrency   int               // files copied at once by copyDirectoryTree, <= 1 copies one by one
+
+	mu       sync.Mutex      // guards verified, which concurrent copies update
+	verified map[string]bool // manifest entries that have been verified
+
+	journal *updateJournal   // --resumable: records each file copied, may be nil
+	resumed map[string]int64 // files an interrupted copy completed, by relative path, with their sizes
+
+	bestEffort  bool          // --best-effort: leave out files that fail to copy and carry on
+	maxFailures int           // most files left out before the copy fails, 0 for no limit
+	failures    []copyFailure // files left out, guarded by mu
+}
+
+// fileCopy is a file copyDirectoryTree has queued for copying into the skeleton
+type fileCopy struct {
+	src, dst string
+	entry    fs.DirEntry
+}
+
+// copyQueued copies the queued files with up to o.concurrency workers. The first
+// error, or cancellation, stops further copies from starting and is returned once
+// the copies in flight have finished.
+func (o *copyOptions) copyQueued(files []fileCopy) error {
+	workers := o.concurrency
+	if workers > len(files) {
+		workers = len(files)
+	}
+	if workers <= 1 {
+		for _, f := range files {
+			if err := o.cancelled(); err != nil {
+				return err
+			}
+			if err := o.copyQueuedFile(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var (
+		wg       sync.WaitGroup
+		failOnce sync.Once
+		firstErr error
+	)
+	jobs := make(chan fileCopy)
+	stop := make(chan struct{})
+	fail := func(err error) {
+		failOnce.Do(func() {
+			firstErr = err
+			close(stop)
+		})
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				if err := o.copyQueuedFile(f); err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, f := range files {
+		if err := o.cancelled(); err != nil {
+			fail(err)
+			break
+		}
+		select {
+		case jobs <- f:
+		case <-stop:
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return firstErr
+}
+
+// copyQueuedFile copies one queued file and records its progress
+func (o *copyOptions) copyQueuedFile(f fileCopy) error {
+	// Stat before copying: reading the file can update its access time
+	info, infoErr := f.entry.Info()
+	if infoErr == nil && o.alreadyCopied(f, info) {
+		o.advance(f.src, 1, info.Size())
+		return nil
+	}
+	if err := o.copyFile(f.src, f.dst); err != nil {
+		return o.tolerate(f.src, f.dst, err)
+	}
+	if infoErr == nil && info.Mode().IsRegular() {
+		if o.preserveTimes {
+			preserveFileTimes(f.dst, info)
+		}
+		o.advance(f.src, 1, info.Size())
+		if relPath, err := filepath.Rel(o.sourceRoot, f.src); err == nil {
+			o.journal.recordCopied(filepath.ToSlash(relPath), info.Size())
+		}
+	}
+	return nil
+}
+
+// tolerate returns err, the failure to copy src to dst, unless --best-effort leaves
+// the file out: it is then recorded and nil is returned, until more files failed
+// than --max-failures allows. Cancellation and checksum mismatches always stop
+// the copy, as they are not a file that happens to be locked.
+func (o *copyOptions) tolerate(src, dst string, err error) error {
+	if !o.bestEffort || o.cancelled() != nil || errors.Is(err, ErrChecksumMismatch) {
+		return err
+	}
+	relPath, relErr := filepath.Rel(o.sourceRoot, src)
+	if relErr != nil {
+		return err
+	}
+	failure := copyFailure{Path: filepath.ToSlash(relPath), Error: err.Error()}
+
+	o.mu.Lock()
+	o.failures = append(o.failures, failure)
+	failed := len(o.failures)
+	o.mu.Unlock()
+
+	if o.maxFailures > 0 && failed > o.maxFailures {
+		return fmt.Errorf("%d files could not be copied, more than --max-failures %d allows: %w", failed, o.maxFailures, err)
+	}
+	warnf("Could not copy %s, leaving it out: %v", failure.Path, err)
+	os.Remove(dst) // No truncated copy is left in its place
+	runSummary.recordCopyFailure(failure)
+	return nil
+}
+
+// leftOut reports whether --best-effort left relPath, slash-separated, out of the copy
+func (o *copyOptions) leftOut(relPath string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, failure := range o.failures {
+		if failure.Path == relPath {
+			return true
+		}
+	}
+	return false
+}
+
+// reportFailures logs how many files --best-effort left out of the copy
+func (o *copyOptions) reportFailures() {
+	o.mu.Lock()
+	failed := len(o.failures)
+	o.mu.Unlock()
+	if failed > 0 {
+		warnf("%d files could not be copied and were left out (--best-effort)", failed)
+	}
+}
+
+// alreadyCopied reports whether an interrupted copy being resumed completed f: the
+// journal lists it, and the installed file has the size of the source and, when
+// the copy is verified against checksums.txt, the listed SHA256. Those files are
+// kept and recorded again; anything else is copied over.
+func (o *copyOptions) alreadyCopied(f fileCopy, info fs.FileInfo) bool {
+	if o.resumed == nil || !info.Mode().IsRegular() {
+		return false
+	}
+	relPath, err := filepath.Rel(o.sourceRoot, f.src)
+	if err != nil {
+		return false
+	}
+	relPath = filepath.ToSlash(relPath)
+
+	size, ok := o.resumed[relPath]
+	if !ok || size != info.Size() {
+		return false
+	}
+	dstInfo, err := os.Lstat(f.dst)
+	if err != nil || !dstInfo.Mode().IsRegular() || dstInfo.Size() != size {
+		return false
+	}
+	if expected, listed := o.checksums[relPath]; listed {
+		if err := verifyChecksum(f.dst, expected); err != nil {
+			debugf("Copying %s again: %v", relPath, err)
+			return false
+		}
+		o.mu.Lock()
+		o.verified[relPath] = true
+		o.mu.Unlock()
+	}
+	o.journal.recordCopied(relPath, size)
+	return true
+}
+
+// newCopyOptions builds the copy options for copying src according to config
+func newCopyOptions(ctx context.Context, src string, config *UpdateConfig) (*copyOptions, error) {
+	opts := &copyOptions{
+		ctx:           ctx,
+		sourceRoot:    src,
+		tracker:       newCopyTracker(src),
+		preserveTimes: !config.NoPreserveTimes,
+		concurrency:   config.CopyConcurrency,
+		bestEffort:    config.BestEffort,
+		maxFailures:   config.MaxFailures,
+	}
+	if opts.concurrency <= 0 {
+		opts.concurrency = runtime.NumCPU()
+	}
+
+	if config.VerifyDuringCopy {
+		checksums, err := loadChecksumManifest(filepath.Join(src, checksumManifestName))
+		if err != nil {
+			return nil, err
+		}
+		infof("Verifying %d files against %s while copying", len(checksums), checksumManifestName)
+		opts.checksums = checksums
+		opts.verified = make(map[string]bool)
+	}
+
+	return opts, nil
+}
+
+// copyFile copies src to dst, verifying it against the manifest in the same pass when listed
+func (o *copyOptions) copyFile(src, dst string) error {
+	if o.checksums == nil {
+		return copyFileRetrying(src, dst)
+	}
+
+	relPath, err := filepath.Rel(o.sourceRoot, src)
+	if err != nil {
+		return err
+	}
+	relPath = filepath.ToSlash(relPath)
+
+	expected, listed := o.checksums[relPath]
+	if !listed {
+		return copyFileRetrying(src, dst)
+	}
+
+	hash := sha256.New()
+	err = retryFileOp(func() error {
+		hash.Reset()
+		return copyFileHashed(src, dst, hash)
+	})
+	if err != nil {
+		return err
+	}
+
+	if actual := fmt.Sprintf("%x", hash.Sum(nil)); actual != expected {
+		return fmt.Errorf("%w for %s: expected %s, got %s", ErrChecksumMismatch, relPath, expected, actual)
+	}
+	o.mu.Lock()
+	o.verified[relPath] = true
+	o.mu.Unlock()
+	return nil
+}
+
+// advance reports files/bytes copied under path to the progress tracker and,
+// when installing the new version, to the run summary
+func (o *copyOptions) advance(path string, files int, bytes int64) {
+	o.tracker.advance(path, files, bytes)
+	if o.sourceRoot != "" {
+		runSummary.recordCopy(files, bytes)
+	}
+}
+
+// cancelled returns the context's error once the copy has been cancelled
+func (o *copyOptions) cancelled() error {
+	if o.ctx == nil {
+		return nil
+	}
+	return o.ctx.Err()
+}
+
+// isSkipped reports whether src, a path in the tree being installed, must not be
+// copied: the current copy is preserved, or the path is excluded
+func (o *copyOptions) isSkipped(src string) bool {
+	return o.sourceRoot != "" && (isPreserved(o.sourceRoot, src) || isExcluded(o.sourceRoot, src))
+}
+
+// verifyInstalledChecksums verifies manifest entries under relDir of an installed tree
+// that were copied without streaming, such as .app bundles copied by ditto
+func (o *copyOptions) verifyInstalledChecksums(installRoot, relDir string) error {
+	prefix := filepath.ToSlash(relDir) + "/"
+	for relPath, expected := range o.checksums {
+		if !strings.HasPrefix(relPath, prefix) {
+			continue
+		}
+		if err := verifyChecksum(filepath.Join(installRoot, filepath.FromSlash(relPath)), expected); err != nil {
+			return fmt.Errorf("%s: %w", relPath, err)
+		}
+		o.verified[relPath] = true
+	}
+	return nil
+}
+
+// verifyManifestComplete fails if the manifest lists files that were never copied
+func (o *copyOptions) verifyManifestComplete() error {
+	for relPath := range o.checksums {
+		if !o.verified[relPath] && !isPreservedRel(relPath) && !isExcludedRel(relPath) && !o.leftOut(relPath) {
+			return fmt.Errorf("%s is listed in %s but missing from the new version", relPath, checksumManifestName)
+		}
+	}
+	return nil
+}
+
+// preserveFileTimes sets the access and modification times of dst to those of the
+// source described by srcInfo. A failure is only logged: the copy itself is fine.
+func preserveFileTimes(dst string, srcInfo fs.FileInfo) {
+	if err := os.Chtimes(dst, accessTime(srcInfo), srcInfo.ModTime()); err != nil {
+		warnf("failed to preserve times of %s: %v", dst, err)
+	}
+}
+
+// newCopyTracker measures the tree about to be copied and returns a progress tracker for it
+func newCopyTracker(src string) *progressTracker {
+	files, bytes, err := measureReplaceable(src)
+	if err != nil {
+		warnf("failed to measure %s, progress will not be reported: %v", src, err)
+		return nil
+	}
+	return newProgressTracker(files, bytes, reportProgress)
+}
+
+// verifyBackupComplete checks that the backup holds as many files and bytes as
+// currentPath held before the move, and that nothing but preserved paths was left behind
+func verifyBackupComplete(currentPath, backupDir string, expectedFiles int, expectedBytes int64) error {
+	files, bytes, err := measureTree(backupDir)
+	if err != nil {
+		return fmt.Errorf("failed to measure backup: %v", err)
+	}
+
+	if files != expectedFiles || bytes != expectedBytes {
+		return fmt.Errorf("backup holds %d files (%d bytes), expected %d files (%d bytes)",
+			files, bytes, expectedFiles, expectedBytes)
+	}
+
+	// Anything in currentPath beyond the backup itself was not moved
+	total, _, err := measureReplaceable(currentPath)
+	if err != nil {
+		return fmt.Errorf("failed to measure current directory: %v", err)
+	}
+	if name := backupEntryName(currentPath, backupDir); name != "" && !isPreservedRel(name) {
+		total -= files
+	}
+	if total != 0 {
+		return fmt.Errorf("%d files were left behind in %s", total, currentPath)
+	}
+
+	infof("Backup verified: %d files (%d bytes)", files, bytes)
+	return nil
+}
+
+// verifyInstalledTree runs the post-copy checks that decide whether the update is kept
+func verifyInstalledTree(currentPath string, config *UpdateConfig, opts *copyOptions) error {
+	opts.reportFailures()
+	if err := verifyRequiredPaths(currentPath, config.RequirePaths); err != nil {
+		return err
+	}
+	if opts.checksums != nil {
+		if err := opts.verifyManifestComplete(); err != nil {
+			return err
+		}
+	}
+	if config.VerifyAfterCopy {
+		if err := verifyCopiedTree(opts.sourceRoot, currentPath, config.VerifyChecksum, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyCopiedTree re-walks the new version and checks that every file arrived
+// in the installed tree complete: same type and size, and with compareHashes the
+// same SHA256. Preserved paths keep the current version's files and are skipped.
+func verifyCopiedTree(src, dst string, compareHashes bool, opts *copyOptions) error {
+	infof("Verifying the installed files against %s", src)
+	files := 0
+	var bytes int64
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := opts.cancelled(); err != nil {
+			return err
+		}
+		if opts.isSkipped(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if opts.leftOut(filepath.ToSlash(relPath)) {
+			return nil
+		}
+		srcInfo, err := d.Info()
+		if err != nil {
+			return err
+		}
+		installedPath := filepath.Join(dst, relPath)
+		installedInfo, err := os.Lstat(installedPath)
+		if err != nil {
+			return fmt.Errorf("%s is missing from the installed tree", relPath)
+		}
+		if srcInfo.Mode().Type() != installedInfo.Mode().Type() {
+			return fmt.Errorf("%s has type %v in the installed tree, expected %v", relPath, installedInfo.Mode().Type(), srcInfo.Mode().Type())
+		}
+		if !srcInfo.Mode().IsRegular() {
+			return nil
+		}
+
+		if installedInfo.Size() != srcInfo.Size() {
+			return fmt.Errorf("%s is %d bytes in the installed tree, expected %d", relPath, installedInfo.Size(), srcInfo.Size())
+		}
+		if compareHashes {
+			expected, err := fileSHA256(path)
+			if err != nil {
+				return err
+			}
+			actual, err := fileSHA256(installedPath)
+			if err != nil {
+				return err
+			}
+			if actual != expected {
+				return fmt.Errorf("%s differs from the new version (%w: SHA256 %s, expected %s)", relPath, ErrChecksumMismatch, actual, expected)
+			}
+		}
+		files++
+		bytes += srcInfo.Size()
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("copy verification failed: %w", err)
+	}
+
+	infof("Verified %d installed files (%d bytes)", files, bytes)
+	return nil
+}
+
+// verifyRequiredPaths checks that every required relative path exists under root
+func verifyRequiredPaths(root string, requiredPaths []string) error {
+	for _, relPath := range requiredPaths {
+		if _, err := os.Stat(filepath.Join(root, relPath)); err != nil {
+			return fmt.Errorf("required path %s is missing from %s", relPath, root)
+		}
+	}
+	return nil
+}
+
+// verifySourceReadable reads every file under root end-to-end, returning the first failure
+func verifySourceReadable(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("cannot access %s: %v", path, err)
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("cannot open %s: %v", path, err)
+		}
+		defer file.Close()
+
+		if _, err := io.Copy(io.Discard, file); err != nil {
+			return fmt.Errorf("cannot read %s: %v", path, err)
+		}
+		return nil
+	})
+}
+
+// installBackup is the previous version, kept after a successful replacement
+// until the caller decides whether the update sticks
+type installBackup struct {
+	dir      string
+	partial  bool           // holds only the files an incremental update overwrote
+	journal  *updateJournal // removed together with the backup, may be nil
+	rollback func() error   // restores the previous version and removes the backup
+}
+
+// newInstallBackup returns the backup left by a full directory replacement
+func newInstallBackup(currentPath, backupDir string, restore func(backupDir, currentPath string) error, j *updateJournal) *installBackup {
+	return &installBackup{
+		dir:     backupDir,
+		journal: j,
+		rollback: func() error {
+			if err := rollbackDirectoryReplace(currentPath, backupDir, restore, j); err != nil {
+				return err
+			}
+			j.remove()
+			return nil
+		},
+	}
+}
+
+// discard removes the backup once the update is final. A nil backup is a no-op.
+func (b *installBackup) discard() {
+	if b == nil {
+		return
+	}
+	infof("Cleaning up backup directory %s", b.dir)
+	if err := removeAllRetrying(b.dir); err != nil {
+		warnf("failed to remove backup directory %s: %v", b.dir, err)
+		// Don't fail here as the update itself succeeded
+		return
+	}
+	b.journal.remove()
+}
+
+// restoreAbortedBackup moves a backup back into currentPath when the replacement
+// stops before anything new was copied. The error says where the backup was kept
+// when it could not be moved back.
+func restoreAbortedBackup(currentPath, backupDir string, restore func(backupDir, currentPath string) error, j *updateJournal) error {
+	if err := restore(backupDir, currentPath); err != nil {
+		errorf("Rollback failed, backup kept at %s: %v", backupDir, err)
+		return fmt.Errorf("backup kept at %s: %v", backupDir, err)
+	}
+	os.RemoveAll(backupDir)
+	j.remove()
+	runSummary.recordRollback()
+	return nil
+}
+
+// rollbackDirectoryReplace discards partially installed files and restores the backup
+func rollbackDirectoryReplace(currentPath, backupDir string, restore func(backupDir, currentPath string) error, j *updateJournal) error {
+	if err := clearDirectory(currentPath, currentPath, backupEntryName(currentPath, backupDir)); err != nil {
+		return fmt.Errorf("failed to remove partially installed files: %v", err)
+	}
+
+	// From here on only previous-version files remain, so recovery must not clear again
+	j.advance(journalRestoring)
+
+	if err := restore(backupDir, currentPath); err != nil {
+		return err
+	}
+	runSummary.recordRollback()
+
+	if err := removeAllRetrying(backupDir); err != nil {
+		warnf("failed to remove backup directory %s: %v", backupDir, err)
+	}
+	return nil
+}
+
+// clearDirectory removes every entry of dir except the one named keep and the
+// preserved paths under root. Mount points are emptied but kept, since they cannot
+// be removed, and so are directories that hold preserved paths.
+func clearDirectory(root, dir, keep string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Name() == keep {
+			continue
+		}
+		entryPath := filepath.Join(dir, entry.Name())
+		if isPreserved(root, entryPath) {
+			continue
+		}
+		if entry.IsDir() && (isMountPoint(entryPath) || preserving()) {
+			if err := clearDirectory(root, entryPath, ""); err != nil {
+				return err
+			}
+			if err := removeEmptiedDirectory(entryPath); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := removeAllRetrying(entryPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isMountPoint reports whether dir sits on a different filesystem than its parent,
+// as bind mounts and volume mounts inside an app directory do
+func isMountPoint(dir string) bool {
+	dirDev, _, err := fileIdentity(dir)
+	if err != nil {
+		return false
+	}
+	parentDev, _, err := fileIdentity(filepath.Dir(dir))
+	if err != nil {
+		return false
+	}
+	return dirDev != parentDev
+}
+
+// removeEmptiedDirectory removes a directory whose contents were moved away.
+// A mount point is left in place: it cannot be removed and will receive the new contents.
+// So is a directory still holding preserved paths, the only entries not moved.
+func removeEmptiedDirectory(dir string) error {
+	if isMountPoint(dir) {
+		infof("Keeping mount point %s, only its contents were moved", dir)
+		return nil
+	}
+	if preserving() {
+		if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+			return nil
+		}
+	}
+	return removeAllRetrying(dir)
+}
+
+// syncDirLogged makes the renames in dir durable, only warning when it cannot,
+// since the replacement itself has already succeeded
+func syncDirLogged(dir string) {
+	if err := syncDir(dir); err != nil {
+		warnf("failed to sync directory %s: %v", dir, err)
+	}
+}
+
+// renameOrCopy moves src to dst. When the rename crosses a filesystem boundary
+// (another mount, a bind mount, or a lower overlayfs layer all fail with EXDEV)
+// it falls back to copying with sync and then removing the source.
+func renameOrCopy(src, dst string) error {
+	err := renameRetrying(src, dst)
+	if err == nil || !isCrossDeviceError(err) {
+		return err
+	}
+
+	infof("Moving %s crosses a filesystem boundary (separate mount or overlay layer), copying instead", src)
+	logTransferDecision(src, filepath.Dir(dst), "copy because of EXDEV fallback")
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		if err := copyDirectoryTree(src, dst, &copyOptions{preserveTimes: true}); err != nil {
+			return fmt.Errorf("cross-device copy of %s failed: %w", src, err)
+		}
+	} else {
+		if err := copyFileRetrying(src, dst); err != nil {
+			return fmt.Errorf("cross-device copy of %s failed: %w", src, err)
+		}
+		if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to set mode on %s: %v", dst, err)
+		}
+		preserveFileTimes(dst, info)
+	}
+
+	return removeAllRetrying(src)
+}
+
+// moveAppBundleDirectoryContents moves directory contents, treating .app bundles as atomic files
+func moveAppBundleDirectoryContents(currentPath, backupDir string) error {
+	entries, err := os.ReadDir(currentPath)
+	if err != nil {
+		return fmt.Errorf("failed to read current directory: %v", err)
+	}
+
+	// Get backup directory name to avoid moving it into itself
+	backupName := backupEntryName(currentPath, backupDir)
+
+	// Move each entry to backup directory
+	for _, entry := range entries {
+		entryPath := filepath.Join(currentPath, entry.Name())
+
+		// Skip the backup directory itself and anything the update must leave alone
+		if entry.Name() == backupName || isPreserved(currentPath, entryPath) {
+			continue
+		}
+		if isExcluded(currentPath, entryPath) {
+			if err := discardExcluded(entryPath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		backupPath := filepath.Join(backupDir, entry.Name())
+
+		if entry.IsDir() && strings.HasSuffix(entry.Name(), ".app") {
+			// Treat .app bundles as atomic files - move the entire bundle
+			infof("Moving .app bundle to backup: %s -> %s", entryPath, backupPath)
+			if err := renameOrCopy(entryPath, backupPath); err != nil {
+				return fmt.Errorf("failed to move .app bundle %s to backup: %v", entryPath, err)
+			}
+		} else if entry.IsDir() {
+			// For regular directories, create directory in backup with original permissions
+			srcInfo, err := os.Stat(entryPath)
+			if err != nil {
+				return fmt.Errorf("failed to stat directory %s: %v", entryPath, err)
+			}
+
+			if err := os.Mkdir(backupPath, srcInfo.Mode()); err != nil {
+				return fmt.Errorf("failed to create backup directory %s: %v", backupPath, err)
+			}
+
+			// Recursively move contents
+			if err := moveDirectoryContents(currentPath, entryPath, backupPath); err != nil {
+				return fmt.Errorf("failed to move directory contents: %v", err)
+			}
+
+			// Remove the original directory after moving contents
+			if err := removeEmptiedDirectory(entryPath); err != nil {
+				return fmt.Errorf("failed to remove original directory %s: %v", entryPath, err)
+			}
+		} else {
+			// Move file to backup
+			if err := renameOrCopy(entryPath, backupPath); err != nil {
+				return fmt.Errorf("failed to move file %s to backup: %v", entryPath, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// copyAppBundleSystem copies a .app bundle using Apple's ditto command
+func copyAppBundleSystem(src, dst string) error {
+	// Stripped-down systems and CI containers may not have ditto
+	dittoPath, err := exec.LookPath("ditto")
+	if err != nil {
+		warnf("ditto is not available (%v), copying .app bundle without it; extended attributes may not be preserved", err)
+		return copyAppBundle(src, dst)
+	}
+
+	infof("Using ditto to copy .app bundle: %s -> %s", src, dst)
+
+	// Use Apple's ditto command which is recommended for .app bundles
+	// ditto preserves all macOS-specific attributes, permissions, and metadata
+	var stderr strings.Builder
+	cmd := newHelperCommand(dittoPath, src, dst)
+	defer cmd.done()
+	cmd.Stdout = nil
+	cmd.Stderr = &stderr
+
+	err = cmd.timedOut(cmd.Run())
+	for _, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+		if line != "" {
+			warnf("[ditto] %s", line)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("ditto failed: %w", err)
+	}
+
+	infof("ditto completed successfully")
+	return nil
+}
+
+// copyFileWithPermissions copies a file with appropriate permissions for .app bundles
+func copyFileWithPermissions(src, dst string) error {
+	sourceFile, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open source file %s: %v", src, err)
+	}
+	defer sourceFile.Close()
+
+	// Create destination directory if it doesn't exist
+	destDir := filepath.Dir(dst)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return fmt.Errorf("failed to create destination directory %s: %v", destDir, err)
+	}
+
+	// Create destination file with write permissions
+	destinationFile, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create destination file %s: %v", dst, err)
+	}
+	defer destinationFile.Close()
+
+	_, err = io.Copy(destinationFile, sourceFile)
+	if err != nil {
+		return fmt.Errorf("failed to copy file content: %v", err)
+	}
+
+	// Sync to ensure all data is written
+	err = destinationFile.Sync()
+	if err != nil {
+		return fmt.Errorf("failed to sync destination file: %v", err)
+	}
+
+	// Close file before changing permissions
+	destinationFile.Close()
+
+	// Keep the source permissions (bundle binaries must stay executable), but make
+	// sure the owner can write the file to avoid permission issues on later updates
+	perm := fs.FileMode(0644)
+	if srcInfo, err := os.Stat(src); err == nil {
+		perm = srcInfo.Mode().Perm() | 0200
+	}
+	if err := os.Chmod(dst, perm); err != nil {
+		warnf("failed to set permissions on %s: %v", dst, err)
+		// Don't return error here as the copy succeeded
+	}
+
+	return nil
+}
+
+// copyAppBundle copies a .app bundle directory without creating destination first
+func copyAppBundle(src, dst string) error {
+	infof("Copying .app bundle directory: %s -> %s", src, dst)
+
+	// Get source directory info
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("failed to stat source: %w", err)
+	}
+
+	// Create destination directory with same permissions
+	if err := os.Mkdir(dst, srcInfo.Mode()); err != nil {
+		return fmt.Errorf("failed to create destination directory: %w", err)
+	}
+
+	// Copy contents using WalkDir
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		destPath := filepath.Join(dst, relPath)
+
+		if d.IsDir() {
+			// Skip the root directory (already created)
+			if path != src {
+				if err := mkdirMode(destPath, dirPerm(d)); err != nil {
+					return fmt.Errorf("failed to create directory %s: %w", destPath, err)
+				}
+			}
+		} else if d.Type()&fs.ModeSymlink != 0 {
+			// Frameworks link Versions/Current and friends, which must stay links
+			target, err := os.Readlink(path)
+			if err != nil {
+				return fmt.Errorf("failed to read symlink %s: %w", path, err)
+			}
+			if err := os.Symlink(target, destPath); err != nil {
+				return fmt.Errorf("failed to create symlink %s: %w", destPath, err)
+			}
+		} else {
+			// Copy file
+			if err := copyFile(path, destPath); err != nil {
+				return fmt.Errorf("failed to copy file %s: %w", path, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// copyAppBundleDirectoryTree copies directory tree, treating .app bundles as atomic files
+func copyAppBundleDirectoryTree(src, dst string, opts *copyOptions) error {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("failed to stat source: %w", err)
+	}
+
+	if err := mkdirMode(dst, srcInfo.Mode()); err != nil {
+		return fmt.Errorf("failed to create destination directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return fmt.Errorf("failed to read source directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if err := opts.cancelled(); err != nil {
+			return err
+		}
+		srcPath := filepath.Join(src, entry.Name())
+		dstPath := filepath.Join(dst, entry.Name())
+		if opts.isSkipped(srcPath) {
+			continue // The current copy is kept, or the path is excluded
+		}
+
+		if entry.IsDir() && strings.HasSuffix(entry.Name(), ".app") {
+			// Treat .app bundles as atomic units using the correct macOS approach
+			infof("Atomic .app bundle replacement: %s -> %s", srcPath, dstPath)
+
+			// Create temporary destination for new .app bundle
+			tempDstPath := tempDirPath(dstPath+".new", true)
+			oldPath := tempDirPath(dstPath+".old", false)
+			os.RemoveAll(tempDstPath) // Clean up any previous failed attempt
+
+			// Copy new .app bundle to temporary location using system cp command
+			infof("Copying .app bundle to temp location: %s", tempDstPath)
+			if err := copyAppBundleSystem(srcPath, tempDstPath); err != nil {
+				os.RemoveAll(tempDstPath) // Clean up on failure
+				return fmt.Errorf("failed to copy .app bundle to temp location: %w", err)
+			}
+
+			// If destination exists, backup the old one
+			if _, err := os.Stat(dstPath); err == nil {
+				os.RemoveAll(oldPath) // Remove any previous backup
+				infof("Backing up existing .app bundle: %s -> %s", dstPath, oldPath)
+				if err := renameOrCopy(dstPath, oldPath); err != nil {
+					os.RemoveAll(tempDstPath) // Clean up temp on failure
+					return fmt.Errorf("failed to backup existing .app bundle: %w", err)
+				}
+			}
+
+			// Atomic move to final location
+			infof("Moving .app bundle to final location: %s -> %s", tempDstPath, dstPath)
+			if err := renameOrCopy(tempDstPath, dstPath); err != nil {
+				// Restore from backup on failure
+				if _, err := os.Stat(oldPath); err == nil {
+					renameOrCopy(oldPath, dstPath)
+				}
+				os.RemoveAll(tempDstPath)
+				return fmt.Errorf("failed to move .app bundle to final location: %w", err)
+			}
+
+			infof("Successfully replaced .app bundle")
+			if opts.checksums != nil {
+				relDir, _ := filepath.Rel(opts.sourceRoot, srcPath)
+				if err := opts.verifyInstalledChecksums(dst, relDir); err != nil {
+					return err
+				}
+			}
+			files, bytes, _ := measureTree(dstPath)
+			opts.advance(srcPath, files, bytes)
+		} else if entry.IsDir() {
+			// For regular directories, recursively copy
+			if err := copyDirectoryTree(srcPath, dstPath, opts); err != nil {
+				return fmt.Errorf("failed to copy directory %s: %w", srcPath, err)
+			}
+		} else {
+			// Copy file, taking its times before reading it updates the access time
+			info, infoErr := entry.Info()
+			if err := opts.copyFile(srcPath, dstPath); err != nil {
+				if err := opts.tolerate(srcPath, dstPath, err); err != nil {
+					return fmt.Errorf("failed to copy file %s: %w", srcPath, err)
+				}
+				continue
+			}
+			if infoErr == nil && info.Mode().IsRegular() {
+				if opts.preserveTimes {
+					preserveFileTimes(dstPath, info)
+				}
+				opts.advance(srcPath, 1, info.Size())
+			}
+		}
+	}
+
+	return nil
+}
+
+// restoreAppBundleDirectoryBackup restores files from backup, treating .app bundles as atomic files
+func restoreAppBundleDirectoryBackup(backupDir, currentPath string) error {
+	entries, err := os.ReadDir(backupDir)
+	if err != nil {
+		return fmt.Errorf("failed to read backup directory: %v", err)
+	}
+
+	// Restore each entry from backup to current path
+	for _, entry := range entries {
+		backupPath := filepath.Join(backupDir, entry.Name())
+		originalPath := filepath.Join(currentPath, entry.Name())
+
+		if entry.IsDir() && strings.HasSuffix(entry.Name(), ".app") {
+			// Treat .app bundles as atomic units - use atomic replacement for restore too
+			infof("Restoring .app bundle: %s -> %s", backupPath, originalPath)
+
+			// If destination exists, backup current version first
+			if _, err := os.Stat(originalPath); err == nil {
+				currentBackup := originalPath + ".current"
+				os.RemoveAll(currentBackup)
+				if err := renameOrCopy(originalPath, currentBackup); err != nil {
+					return fmt.Errorf("failed to backup current .app bundle during restore: %v", err)
+				}
+				defer func() {
+					if _, err := os.Stat(originalPath); os.IsNotExist(err) {
+						// Restore succeeded, clean up current backup
+						os.RemoveAll(currentBackup)
+					} else {
+						// Restore failed, restore from current backup
+						renameOrCopy(currentBackup, originalPath)
+					}
+				}()
+			}
+
+			// Move from backup to original location
+			if err := renameOrCopy(backupPath, originalPath); err != nil {
+				return fmt.Errorf("failed to restore .app bundle %s: %v", backupPath, err)
+			}
+		} else if entry.IsDir() {
+			// For regular directories, create it first
+			if err := os.MkdirAll(originalPath, 0755); err != nil {
+				return fmt.Errorf("failed to create directory %s: %v", originalPath, err)
+			}
+			// Recursively restore directory contents
+			if err := restoreDirectoryContents(backupPath, originalPath); err != nil {
+				return fmt.Errorf("failed to restore directory contents: %v", err)
+			}
+		} else {
+			// Move file back from backup
+			if err := renameOrCopy(backupPath, originalPath); err != nil {
+				return fmt.Errorf("failed to restore file %s: %v", backupPath, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// moveContentsToBackup moves all contents of currentPath to backupDir
+func moveContentsToBackup(currentPath, backupDir string) error {
+	// First, read the current directory contents
+	entries, err := os.ReadDir(currentPath)
+	if err != nil {
+		return fmt.Errorf("failed to read current directory: %v", err)
+	}
+
+	// Get backup directory name to avoid moving it into itself
+	backupName := backupEntryName(currentPath, backupDir)
+
+	// Move each entry to backup directory
+	for _, entry := range entries {
+		entryPath := filepath.Join(currentPath, entry.Name())
+
+		// Skip the backup directory itself and anything the update must leave alone
+		if entry.Name() == backupName || isPreserved(currentPath, entryPath) {
+			continue
+		}
+		if isExcluded(currentPath, entryPath) {
+			if err := discardExcluded(entryPath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		backupPath := filepath.Join(backupDir, entry.Name())
+
+		if entry.IsDir() {
+			// Get original directory permissions
+			srcInfo, err := os.Stat(entryPath)
+			if err != nil {
+				return fmt.Errorf("failed to stat directory %s: %v", entryPath, err)
+			}
+
+			// Create directory in backup with original permissions
+			if err := os.Mkdir(backupPath, srcInfo.Mode()); err != nil {
+				return fmt.Errorf("failed to create backup directory %s: %v", backupPath, err)
+			}
+
+			// For directories, we need to move contents recursively
+			if err := moveDirectoryContents(currentPath, entryPath, backupPath); err != nil {
+				return fmt.Errorf("failed to move directory contents: %v", err)
+			}
+
+			// Remove the original directory after moving contents
+			if err := removeEmptiedDirectory(entryPath); err != nil {
+				return fmt.Errorf("failed to remove original directory %s: %v", entryPath, err)
+			}
+		} else {
+			// Move file to backup
+			if err := renameOrCopy(entryPath, backupPath); err != nil {
+				return fmt.Errorf("failed to move file %s to backup: %v", entryPath, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// moveDirectoryContents recursively moves directory contents, leaving the preserved paths under root
+func moveDirectoryContents(root, srcDir, dstDir string) error {
+	entries, err := os.ReadDir(srcDir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		srcPath := filepath.Join(srcDir, entry.Name())
+		dstPath := filepath.Join(dstDir, entry.Name())
+		if isPreserved(root, srcPath) {
+			continue
+		}
+		if isExcluded(root, srcPath) {
+			if err := discardExcluded(srcPath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if entry.IsDir() {
+			// Get original directory permissions
+			srcInfo, err := os.Stat(srcPath)
+			if err != nil {
+				return err
+			}
+
+			// Create directory with original permissions
+			if err := mkdirMode(dstPath, srcInfo.Mode()); err != nil {
+				return fmt.Errorf("failed to create directory %s: %v", dstPath, err)
+			}
+
+			// Recursively move contents
+			if err := moveDirectoryContents(root, srcPath, dstPath); err != nil {
+				return err
+			}
+
+			// Remove original directory after moving contents
+			if err := removeEmptiedDirectory(srcPath); err != nil {
+				return fmt.Errorf("failed to remove original directory %s: %v", srcPath, err)
+			}
+		} else {
+			// Move file
+			if err := renameOrCopy(srcPath, dstPath); err != nil {
+				return fmt.Errorf("failed to move file %s to %s: %v", srcPath, dstPath, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// restoreFromBackup restores files from backupDir to currentPath
+func restoreFromBackup(backupDir, currentPath string) error {
+	// Read backup directory contents
+	entries, err := os.ReadDir(backupDir)
+	if err != nil {
+		return fmt.Errorf("failed to read backup directory: %v", err)
+	}
+
+	// Restore each entry from backup to current path
+	for _, entry := range entries {
+		backupPath := filepath.Join(backupDir, entry.Name())
+		originalPath := filepath.Join(currentPath, entry.Name())
+
+		if entry.IsDir() {
+			// For directories, create it first
+			if err := mkdirMode(originalPath, dirPerm(entry)); err != nil {
+				return fmt.Errorf("failed to create directory %s: %v", originalPath, err)
+			}
+			// Recursively restore directory contents
+			if err := restoreDirectoryContents(backupPath, originalPath); err != nil {
+				return fmt.Errorf("failed to restore directory contents: %v", err)
+			}
+		} else {
+			// Move file back from backup
+			if err := renameOrCopy(backupPath, originalPath); err != nil {
+				return fmt.Errorf("failed to restore file %s: %v", backupPath, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// restoreDirectoryContents recursively restores directory contents
+func restoreDirectoryContents(backupPath, originalPath string) error {
+	entries, err := os.ReadDir(backupPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		srcPath := filepath.Join(backupPath, entry.Name())
+		dstPath := filepath.Join(originalPath, entry.Name())
+
+		if entry.IsDir() {
+			// Get original permissions from backup
+			srcInfo, err := os.Stat(srcPath)
+			if err != nil {
+				return err
+			}
+
+			// Create directory with original permissions
+			if err := mkdirMode(dstPath, srcInfo.Mode()); err != nil {
+				return fmt.Errorf("failed to create directory %s: %v", dstPath, err)
+			}
+
+			// Recursively restore contents
+			if err := restoreDirectoryContents(srcPath, dstPath); err != nil {
+				return err
+			}
+		} else {
+			// Restore file
+			if err := renameOrCopy(srcPath, dstPath); err != nil {
+				return fmt.Errorf("failed to restore file %s to %s: %v", srcPath, dstPath, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// dirPerm returns the permission bits of directory entry d, with its setgid and
+// sticky bits, defaulting to 0755
+func dirPerm(d fs.DirEntry) fs.FileMode {
+	info, err := d.Info()
+	if err != nil {
+		return 0755
+	}
+	return info.Mode() & (fs.ModePerm | fs.ModeSetgid | fs.ModeSticky)
+}
+
+// mkdirMode creates the directory path and any missing parents and gives path
+// exactly mode. MkdirAll alone leaves the mode to the umask and does not touch a
+// directory that exists, so an empty directory an app relies on, such as
+// plugins/ or a world-writable tmp/, would not match the new version.
+func mkdirMode(path string, mode fs.FileMode) error {
+	if err := os.MkdirAll(path, mode.Perm()); err != nil {
+		return err
+	}
+	return os.Chmod(path, mode&(fs.ModePerm|fs.ModeSetgid|fs.ModeSticky))
+}
+
+// copyDirectoryTree recursively copies a directory tree
+func copyDirectoryTree(src, dst string, opts *copyOptions) error {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("failed to stat source: %w", err)
+	}
+
+	if err := mkdirMode(dst, srcInfo.Mode()); err != nil {
+		return fmt.Errorf("failed to create destination directory: %w", err)
+	}
+
+	// Directory times change as files are added, so they are applied after the copy
+	type dirTime struct {
+		path string
+		info fs.FileInfo
+	}
+	var dirTimes []dirTime
+
+	// Build the directory skeleton first, then copy the files into it
+	var files []fileCopy
+	err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := opts.cancelled(); err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		destPath := filepath.Join(dst, relPath)
+
+		if opts.isSkipped(path) {
+			// The current copy is kept, or the path is excluded
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			if opts.preserveTimes {
+				if info, err := d.Info(); err == nil {
+					dirTimes = append(dirTimes, dirTime{destPath, info})
+				}
+			}
+			return mkdirMode(destPath, dirPerm(d))
+		}
+
+		files = append(files, fileCopy{src: path, dst: destPath, entry: d})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := opts.copyQueued(files); err != nil {
+		return err
+	}
+
+	// WalkDir visits parents first, so walking backwards restores the deepest directories first
+	for i := len(dirTimes) - 1; i >= 0; i-- {
+		preserveFileTimes(dirTimes[i].path, dirTimes[i].info)
+	}
+	return nil
+}
+
+// matchesAnyPattern reports whether relPath matches one of the glob patterns.
+// Patterns containing a slash are matched against the whole relative path,
+// others against the file name at any depth.
+func matchesAnyPattern(relPath string, patterns []string) bool {
+	slashPath := filepath.ToSlash(relPath)
+	for _, pattern := range patterns {
+		pattern = filepath.ToSlash(pattern)
+		target := slashPath
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(slashPath)
+		}
+		if matched, _ := path.Match(pattern, target); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// applyExecutableBits adds execute permission to files under root matching any pattern
+func applyExecutableBits(root string, patterns []string) error {
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	// Windows has no executable permission bit
+	if runtime.GOOS == "windows" {
+		infof("Skipping --make-executable on Windows")
+		return nil
+	}
+
+	return filepath.WalkDir(root, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		if !matchesAnyPattern(relPath, patterns) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		debugf("Making executable: %s", relPath)
+		if err := os.Chmod(filePath, info.Mode().Perm()|0111); err != nil {
+			return fmt.Errorf("failed to make %s executable: %v", filePath, err)
+		}
+		return nil
+	})
+}
+
+// launchApplication launches the updated application with smart detection
+func launchApplication(appPath, appName string) (int, error) {
+	if appPath == "" {
+		return 0, fmt.Errorf("app path is empty")
+	}
+
+	absPath, err := filepath.Abs(appPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve app path: %w", err)
+	}
+
+	infof("Launching application: %s", absPath)
+
+	appType, err := DetectApplicationType(absPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to detect app type: %w", err)
+	}
+
+	switch appType {
+	case SingleFile, LinuxAppImage:
+		return launchSingleFile(absPath)
+	case MacAppBundle:
+		return launchMacAppBundle(absPath)
+	case MacAppBundleDirectory:
+		return launchMacAppBundleDirectory(absPath, appName)
+	case MacDirectory:
+		return launchMacDirectory(absPath, appName)
+	case WindowsAppDirectory:
+		return launchWindowsApp(absPath, appName)
+	case LinuxAppDirectory:
+		return launchLinuxApp(absPath, appName)
+	default:
+		return 0, fmt.Errorf("unsupported app type for launch: %v", appType)
+	}
+}
+
+// Launch starts the application at path the way an update relaunches it, using
+// appName (a comma-separated list tried in order) to pick the executable in a
+// directory when several are present
+func Launch(path, appName string) error {
+	_, err := launchApplication(path, appName)
+	return err
+}
+
+// launchSingleFile launches a single executable file
+func launchSingleFile(appPath string) (int, error) {
+	workDir := filepath.Dir(appPath)
+
+	infof("Launching single file: %s", appPath)
+
+	cmd := exec.Command(appPath)
+	cmd.Dir = workDir
+	cmd.Env = launchEnv()
+	cmd.Stdin = nil
+	cmd.Stdout = nil
+	cmd.Stderr = nil
+	cmd.SysProcAttr = detachedProcAttr()
+
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to launch single file: %w", err)
+	}
+
+	infof("Single file launched with PID: %d", cmd.Process.Pid)
+	return cmd.Process.Pid, nil
+}
+
+// launchMacAppBundleDirectory launches the first .app bundle found in a directory,
+// or the first one named like appName when it is given
+func launchMacAppBundleDirectory(appPath, appName string) (int, error) {
+	infof("Launching first .app bundle from directory: %s", appPath)
+	appNames := appNameCandidates(appName)
+
+	// Find the first .app bundle in the directory
+	entries, err := os.ReadDir(appPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	var firstAppBundle string
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasSuffix(entry.Name(), ".app") && (len(appNames) == 0 || matchesAppName(entry.Name(), appNames)) {
+			firstAppBundle = filepath.Join(appPath, entry.Name())
+			break
+		}
+	}
+
+	if firstAppBundle == "" {
+		return 0, fmt.Errorf("no .app bundle found in directory: %s", appPath)
+	}
+
+	infof("Found .app bundle: %s", firstAppBundle)
+	return launchMacAppBundle(firstAppBundle)
+}
+
+// launchMacAppBundle launches a macOS .app bundle
+func launchMacAppBundle(appPath string) (int, error) {
+	workDir := filepath.Dir(appPath)
+
+	infof("Launching macOS app bundle: %s", appPath)
+
+	// Use 'open' command for .app bundles
+	cmd := newHelperCommand("open", appPath)
+	defer cmd.done()
+	cmd.Dir = workDir
+	cmd.Env = launchEnv()
+	cmd.Stdin = nil
+	cmd.Stdout = nil
+	cmd.Stderr = nil
+	cmd.SysProcAttr = detachedProcAttr()
+
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to launch macOS app bundle: %w", err)
+	}
+
+	// 'open' hands the launch to Launch Services and exits, so its PID is not the app's
+	pid, err := findBundleProcess(appPath, cmd)
+	if err != nil {
+		warnf("Could not determine the PID of %s, reporting the 'open' helper's PID %d: %v", appPath, cmd.Process.Pid, err)
+		return cmd.Process.Pid, nil
+	}
+	infof("macOS app bundle launched with PID: %d", pid)
+	return pid, nil
+}
+
+// bundleProcessTimeout bounds how long findBundleProcess looks for the launched app
+const bundleProcessTimeout = 5 * time.Second
+
+// findBundleProcess waits for the 'open' command that launched the bundle at
+// appPath to finish and returns the PID of the running CFBundleExecutable. When
+// several processes share that name, the newest (highest) PID is taken.
+func findBundleProcess(appPath string, open *helperCommand) (int, error) {
+	if err := open.timedOut(open.Wait()); err != nil {
+		return 0, fmt.Errorf("open failed: %w", err)
+	}
+
+	exePath, err := bundleExecutable(appPath)
+	if err != nil {
+		return 0, err
+	}
+	name := filepath.Base(exePath)
+
+	deadline := time.Now().Add(bundleProcessTimeout)
+	for {
+		pids, err := findProcessesByName(name)
+		if err != nil {
+			return 0, err
+		}
+		if len(pids) > 0 {
+			return pids[len(pids)-1], nil
+		}
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("no process named %s after %v", name, bundleProcessTimeout)
+		}
+		time.Sleep(processPollInterval)
+	}
+}
+
+// launchMacDirectory launches a macOS directory with executables
+func launchMacDirectory(appPath, appName string) (int, error) {
+	workDir := filepath.Dir(appPath)
+
+	// Find the executable to launch
+	executable, err := findExecutableInDirectory(appPath, appNameCandidates(appName))
+	if err != nil {
+		return 0, fmt.Errorf("failed to find executable: %w", err)
+	}
+
+	infof("Launching macOS directory app: %s", executable)
+
+	cmd := exec.Command(executable)
+	cmd.Dir = workDir
+	cmd.Env = launchEnv()
+	cmd.Stdin = nil
+	cmd.Stdout = nil
+	cmd.Stderr = nil
+	cmd.SysProcAttr = detachedProcAttr()
+
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to launch macOS directory app: %w", err)
+	}
+
+	infof("macOS directory app launched with PID: %d", cmd.Process.Pid)
+	return cmd.Process.Pid, nil
+}
+
+// launchWindowsApp launches a Windows application from a directory
+func launchWindowsApp(appPath, appName string) (int, error) {
+	workDir := filepath.Dir(appPath)
+
+	// Find the executable to launch
+	executable, err := findExecutableInDirectory(appPath, appNameCandidates(appName))
+	if err != nil {
+		return 0, fmt.Errorf("failed to find executable: %w", err)
+	}
+
+	infof("Launching Windows app: %s", executable)
+
+	cmd := exec.Command(executable)
+	cmd.Dir = workDir
+	cmd.Env = launchEnv()
+	cmd.Stdin = nil
+	cmd.Stdout = nil
+	cmd.Stderr = nil
+	cmd.SysProcAttr = detachedProcAttr()
+
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to launch Windows app: %w", err)
+	}
+
+	infof("Windows app launched with PID: %d", cmd.Process.Pid)
+	return cmd.Process.Pid, nil
+}
+
+// launchLinuxApp launches a Linux application from a directory
+func launchLinuxApp(appPath, appName string) (int, error) {
+	workDir := filepath.Dir(appPath)
+
+	// A .desktop file starts the app the way its packager intended
+	var cmd *exec.Cmd
+	if entry := findDesktopEntry(appPath, appNameCandidates(appName)); entry != nil {
+		infof("Launching Linux app from %s: %s", entry.path, strings.Join(entry.args, " "))
+		cmd = exec.Command(entry.args[0], entry.args[1:]...)
+		if entry.dir != "" {
+			workDir = entry.dir
+		}
+	} else {
+		// Find the executable to launch
+		executable, err := findExecutableInDirectory(appPath, appNameCandidates(appName))
+		if err != nil {
+			return 0, fmt.Errorf("failed to find executable: %w", err)
+		}
+
+		infof("Launching Linux app: %s", executable)
+		cmd = exec.Command(executable)
+	}
+
+	cmd.Dir = workDir
+	cmd.Env = launchEnv()
+	cmd.Stdin = nil
+	cmd.Stdout = nil
+	cmd.Stderr = nil
+	cmd.SysProcAttr = detachedProcAttr()
+
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to launch Linux app: %w", err)
+	}
+
+	infof("Linux app launched with PID: %d", cmd.Process.Pid)
+	return cmd.Process.Pid, nil
+}
+
+// verifyChecksum verifies the SHA256 checksum of a file
+func verifyChecksum(filePath, expectedChecksum string) error {
+	actualChecksum, err := fileSHA256(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file for checksum: %v", err)
+	}
+
+	if actualChecksum != expectedChecksum {
+		return fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, expectedChecksum, actualChecksum)
+	}
+
+	debugf("Checksum verification passed for %s", filePath)
+	return nil
+}
+
+// getExecutableDir returns the directory containing the atom-updater executable
+func getExecutableDir() string {
+	execPath, err := os.Executable()
+	if err != nil {
+		return "." // fallback to current directory
+	}
+	return filepath.Dir(execPath)
+}
+
+// isUpdaterInside reports whether the running atom-updater executable is path or lies
+// inside it. Symlinks are resolved so an aliased install directory is still caught.
+func isUpdaterInside(path string) bool {
+	execPath, err := os.Executable()
+	if err != nil {
+		return false
+	}
+	if resolved, err := filepath.EvalSymlinks(execPath); err == nil {
+		execPath = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return isPathWithin(execPath, path)
+}
+
+// applyRunSettings sets the package variables that hold config's settings for
+// the run. Every one is assigned, to its default when config leaves it unset, so
+// nothing carries over from an earlier Update call.
+func applyRunSettings(config *UpdateConfig) {
+	setLogLevel(config.LogLevel, config.Verbose)
+	executableSearchDepth = config.ExecSearchDepth
+	ignorePatterns = config.Ignore
+	appVersionFile = versionFileName
+	if config.VersionFile != "" {
+		appVersionFile = config.VersionFile
+	}
+	bufferSize := defaultCopyBufferSize
+	if config.CopyBufferSize > 0 {
+		bufferSize = config.CopyBufferSize
+	}
+	setCopyBufferSize(bufferSize)
+	useCopyFileRange = config.CopyFileRange
+	copyRateLimiter = newRateLimiter(config.MaxCopyRate)
+	subprocessTimeout = defaultSubprocessTimeout
+	if config.SubprocessTimeout > 0 {
+		subprocessTimeout = time.Duration(config.SubprocessTimeout) * time.Second
+	}
+	hashCache = nil
+	preservePatterns = config.Preserve
+	excludePatterns = config.Exclude
+	wrappedBundle = ""
+	verifiedArchive = ""
+	tempDir = config.TmpDir
+	fileRetryAttempts = defaultFileRetryAttempts
+	if config.RetryAttempts > 0 {
+		fileRetryAttempts = config.RetryAttempts
+	}
+	fileRetryBackoff = defaultFileRetryBackoff
+	if config.RetryBackoffMS > 0 {
+		fileRetryBackoff = time.Duration(config.RetryBackoffMS) * time.Millisecond
+	}
+	progressOutput = nil
+	handoffSocket = ""
+}
+
+// updateMu serializes Update calls. The settings of a run are kept in package
+// variables read by the copy, search and logging helpers, so two updates in one
+// process cannot run at the same time; a second call waits for the first.
+var updateMu sync.Mutex
+
+// Update replaces cfg.CurrentPath with the new version at cfg.NewPath and relaunches
+// it, doing everything the atom-updater command does after parsing its arguments.
+// Progress is logged through the standard log package. A failure is returned with
+// one of the Exit* codes attached; see ExitCode. Update is not reentrant: calls
+// from several goroutines run one after the other.
+func Update(cfg UpdateConfig) error {
+	return UpdateContext(context.Background(), cfg)
+}
+
+// UpdateContext is Update with cancellation. Cancelling ctx while waiting for the
+// process or copying the new version stops the update and rolls back to the
+// previous version, and the returned error wraps ctx.Err() with ExitCancelled
+// attached. Once the new version is fully in place the update runs to completion.
+func UpdateContext(ctx context.Context, cfg UpdateConfig) error {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+
+	config := &cfg
+	runSummary.reset(config.DryRun)
+	if err := config.normalize(); err != nil {
+		return withExitCode(ExitBadArgs, err)
+	}
+
+	applyRunSettings(config)
+	if config.ChecksumCache != "" {
+		hashCache = loadChecksumCache(config.ChecksumCache)
+		defer hashCache.save()
+	}
+	if tempDir != "" {
+		if err := os.MkdirAll(tempDir, 0755); err != nil {
+			return withExitCode(ExitBadArgs, fmt.Errorf("failed to create temp directory: %w", err))
+		}
+	}
+
+	progressFile, err := openProgressOutput(config)
+	if err != nil {
+		return withExitCode(ExitBadArgs, fmt.Errorf("progress output: %w", err))
+	}
+	if progressFile != nil {
+		defer progressFile.Close()
+		progressOutput = progressFile
+		defer func() { progressOutput = nil }()
+	}
+
+	infof("Starting update process:")
+	if config.PID > 0 {
+		infof("  PID: %d", config.PID)
+	}
+	if config.WaitProcessName != "" {
+		infof("  Wait for process name: %s", config.WaitProcessName)
+	}
+	infof("  Current path: %s", config.CurrentPath)
+	infof("  New path: %s", config.NewPath)
+	if config.AppName != "" {
+		infof("  App name: %s", config.AppName)
+	}
+
+	if err := wrapBundleArgs(config); err != nil {
+		return withExitCode(ExitBadArgs, err)
+	}
+
+	// Validate that both paths are directories (not files or .app bundles),
+	// or both files when single-file updates were asked for
+	currentInfo, err := os.Stat(config.CurrentPath)
+	if os.IsNotExist(err) {
+		return withExitCode(ExitBadArgs, fmt.Errorf("current application %w: %s", ErrPathNotFound, config.CurrentPath))
+	} else if err != nil {
+		return withExitCode(ExitBadArgs, fmt.Errorf("cannot access current application %s: %w", config.CurrentPath, err))
+	}
+	if !currentInfo.IsDir() && !config.AllowSingleFile && !config.Force && !isAppImage(config.CurrentPath, currentInfo) {
+		return withExitCode(ExitBadArgs, fmt.Errorf("current path must be a directory, not a file (use --allow-single-file for single binaries, or --force to replace it with a directory): %s", config.CurrentPath))
+	}
+
+	newInfo, err := os.Stat(config.NewPath)
+	if os.IsNotExist(err) {
+		return withExitCode(ExitBadArgs, fmt.Errorf("new application %w: %s", ErrPathNotFound, config.NewPath))
+	} else if err != nil {
+		return withExitCode(ExitBadArgs, fmt.Errorf("cannot access new application %s: %w", config.NewPath, err))
+	}
+
+	// A release archive is unpacked and the update proceeds from the extracted directory
+	if !newInfo.IsDir() && currentInfo.IsDir() && isArchivePath(config.NewPath) {
+		// Nothing from a corrupted or tampered download is written to disk
+		if config.Checksum != "" {
+			if err := verifyChecksum(config.NewPath, strings.ToLower(config.Checksum)); err != nil {
+				return fmt.Errorf("archive failed checksum verification: %s: %w", config.NewPath, err)
+			}
+			infof("Archive checksum verified: %s", config.NewPath)
+			verifiedArchive = config.NewPath
+		}
+		infof("Extracting %s", config.NewPath)
+		extractedPath, err := extractArchiveToTemp(config.NewPath)
+		if err != nil {
+			return withExitCode(ExitBadArgs, err)
+		}
+		removeExtracted := func() {
+			if err := removeExtractedArchive(extractedPath); err != nil {
+				warnf("Failed to remove extracted archive %s: %v", extractedPath, err)
+			}
+		}
+		defer removeExtracted()
+
+		infof("  Extracted to: %s", extractedPath)
+		config.NewPath = extractedPath
+		if newInfo, err = os.Stat(extractedPath); err != nil {
+			return withExitCode(ExitUnexpected, fmt.Errorf("extracted archive is not accessible: %w", err))
+		}
+	}
+	if !newInfo.IsDir() && !config.AllowSingleFile && !config.Force && !isAppImage(config.NewPath, newInfo) {
+		return withExitCode(ExitBadArgs, fmt.Errorf("new path must be a directory or a .zip/.tar.gz archive, not a file (use --allow-single-file for single binaries): %s", config.NewPath))
+	}
+	if currentInfo.IsDir() != newInfo.IsDir() && !config.Force {
+		return withExitCode(ExitIncompatible, fmt.Errorf("%w: current and new paths must both be directories or both be files: %s, %s", ErrIncompatibleTypes, config.CurrentPath, config.NewPath))
+	}
+	if !currentInfo.IsDir() && (config.Harden || len(config.Preserve) > 0) {
+		return withExitCode(ExitBadArgs, errors.New("--harden and --preserve apply to directories and cannot be used with a single file"))
+	}
+
+	// Additional validation: don't allow .app bundles as direct arguments
+	if strings.HasSuffix(config.CurrentPath, ".app") {
+		return withExitCode(ExitBadArgs, fmt.Errorf("current path cannot be a .app bundle, must be a directory (or use --auto-wrap-bundle): %s", config.CurrentPath))
+	}
+	if strings.HasSuffix(config.NewPath, ".app") {
+		return withExitCode(ExitBadArgs, fmt.Errorf("new path cannot be a .app bundle, must be a directory (or use --auto-wrap-bundle): %s", config.NewPath))
+	}
+
+	// atomicReplace checks this again, but finding out here spares stopping the app
+	if err := checkDistinctPaths(config.CurrentPath, config.NewPath); err != nil {
+		return withExitCode(ExitBadArgs, err)
+	}
+
+	// Replacing the directory we run from moves our own binary and log file mid-update
+	if !config.AllowSelfUpdate {
+		for _, path := range []string{config.CurrentPath, config.NewPath} {
+			if isUpdaterInside(path) {
+				return withExitCode(ExitBadArgs, fmt.Errorf("the updater runs from %s, which is inside %s. Updating it would move or overwrite the running "+
+					"updater and its log file halfway through, which can leave a broken installation. Run the "+
+					"updater from outside the application directory, or pass --allow-self-update to proceed anyway",
+					getExecutableDir(), path))
+			}
+		}
+	}
+
+	// A wrong PID would stop an unrelated application and replace this one under it
+	if config.VerifyPIDOwnsPath && config.PID > 0 {
+		if err := checkPIDOwnsPath(config.PID, config.CurrentPath, config.StrictPIDCheck); err != nil {
+			return withExitCode(ExitBadArgs, err)
+		}
+	}
+
+	// Step 1: Wait for the target process to exit
+	// In handoff mode the old instance keeps running until the new one takes over
+	if config.DryRun {
+		infof("Dry run: not waiting for the application to exit, nothing will be modified")
+	} else if config.HandoffSocket != "" {
+		infof("Handoff mode: process %d keeps running during the update", config.PID)
+		handoffSocket = config.HandoffSocket
+		defer func() { handoffSocket = "" }()
+	} else if config.NoWait || (config.PID == 0 && config.WaitProcessName == "") {
+		infof("Not waiting for any process to exit")
+	} else if err := waitForTargetProcesses(ctx, config); err != nil {
+		return err
+	}
+
+	// Step 2: Perform atomic replacement
+	oldVersion := readAppVersion(config.CurrentPath)
+	backup, err := atomicReplace(ctx, config.CurrentPath, config.NewPath, config)
+	if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return withExitCode(ExitCancelled, fmt.Errorf("update cancelled, previous version kept: %w", err))
+	}
+	if err != nil {
+		return withExitCode(exitCodeOf(err, ExitReplaceFailed), fmt.Errorf("atomic replacement failed: %w", err))
+	}
+	if config.DryRun {
+		infof("Dry run complete, the update would be accepted")
+		return nil
+	}
+
+	// Make sure the binaries the caller listed are executable before launch
+	if err := applyExecutableBits(config.CurrentPath, config.MakeExecutable); err != nil {
+		warnf("Failed to apply executable bits: %v", err)
+	}
+
+	// A quarantined download would make Gatekeeper question the relaunch
+	if config.ClearQuarantine {
+		if err := clearQuarantine(config.CurrentPath); err != nil {
+			warnf("Failed to clear quarantine: %v", err)
+		}
+	}
+
+	// Start menu, desktop and taskbar shortcuts may name an executable the new version renamed
+	if config.RefreshShortcuts {
+		if err := refreshShortcuts(config.CurrentPath, config.AppName); err != nil {
+			warnf("Failed to refresh shortcuts: %v", err)
+		}
+	}
+
+	// Migrations and other post-update steps run while the previous version is still at hand
+	if config.PostUpdateCmd != "" {
+		var oldPath string
+		if backup != nil {
+			oldPath = backup.dir
+		}
+		err := runHook(ctx, "post-update", config.PostUpdateCmd, hookDir(config.CurrentPath), hookEnv(config, oldPath, oldVersion, readAppVersion(config.CurrentPath)))
+		if err != nil && config.RollbackOnHookFailure && backup != nil {
+			warnf("%v, rolling back", err)
+			if rollbackErr := rollbackUnhealthyUpdate(config, backup, 0); rollbackErr != nil {
+				return fmt.Errorf("CRITICAL: %w", rollbackErr)
+			}
+			return withExitCode(ExitReplaceFailed, fmt.Errorf("update rolled back: %w", err))
+		} else if err != nil {
+			warnf("%v, keeping the update", err)
+		}
+	}
+
+	// Keep the previous version around until the new one has proven healthy
+	verifyAfterLaunch := config.HealthCheckURL != "" || config.LaunchVerifySeconds > 0 || config.WatchdogTimeout > 0
+	if !verifyAfterLaunch {
+		finalizeBackup(backup, config)
+	}
+
+	// Leave a marker so the relaunched app knows it was just updated
+	if config.UpdateMarker != "" {
+		marker := UpdateMarker{
+			OldVersion:     oldVersion,
+			NewVersion:     readAppVersion(config.CurrentPath),
+			UpdatedAt:      time.Now().UTC(),
+			AppPath:        config.CurrentPath,
+			UpdaterVersion: Version,
+		}
+		if err := writeUpdateMarker(config.UpdateMarker, marker); err != nil {
+			warnf("Failed to write update marker: %v", err)
+		}
+	}
+
+	// Lock down the installed files and only launch them once they verify
+	if config.Harden {
+		if err := hardenInstallation(config.CurrentPath); err != nil {
+			warnf("Failed to harden installation: %v", err)
+		}
+		if err := verifyInstallation(config.CurrentPath); err != nil {
+			return withExitCode(ExitReplaceFailed, fmt.Errorf("installed version failed verification, not launching: %w", err))
+		}
+	}
+
+	if config.NoLaunch {
+		infof("Not launching the updated application (--no-launch)")
+		infof("Update process completed successfully")
+		return nil
+	}
+
+	// Step 3: Launch the updated application
+	var newPID int
+	err = injectFailure(phaseLaunch)
+	if err == nil {
+		newPID, err = launchApplication(config.CurrentPath, config.AppName)
+	}
+	if err == nil {
+		runSummary.update(func(sum *updateSummary) { sum.LaunchedPID = newPID })
+		if config.PIDFile != "" {
+			if pidErr := writePIDFile(config.PIDFile, newPID); pidErr != nil {
+				warnf("%v", pidErr)
+			}
+		}
+	}
+	if err != nil {
+		warnf("Failed to launch updated application: %v", err)
+		// Don't exit here as the replacement was successful, unless it must prove healthy
+		if verifyAfterLaunch && backup != nil {
+			if rollbackErr := rollbackUnhealthyUpdate(config, backup, 0); rollbackErr != nil {
+				return fmt.Errorf("CRITICAL: %w", rollbackErr)
+			}
+			return withExitCode(ExitHealthFailed, errors.New("update rolled back: updated application could not be launched"))
+		}
+	} else {
+		if config.WatchdogTimeout > 0 && backup != nil {
+			// Unattended updates must not leave a broken app behind
+			timeout := time.Duration(config.WatchdogTimeout) * time.Second
+			if err := runWatchdog(config, newPID, timeout); err != nil {
+				warnf("Watchdog: updated application never became healthy, rolling back: %v", err)
+				if rollbackErr := rollbackUnhealthyUpdate(config, backup, newPID); rollbackErr != nil {
+					return fmt.Errorf("CRITICAL: %w", rollbackErr)
+				}
+				return withExitCode(ExitWatchdog, fmt.Errorf("update rolled back by the watchdog: %w", err))
+			}
+		}
+
+		if config.LaunchVerifySeconds > 0 && backup != nil {
+			// Catch an update that crashes on startup while the previous version is still at hand
+			period := time.Duration(config.LaunchVerifySeconds) * time.Second
+			if err := verifyLaunch(config, newPID, period); err != nil {
+				warnf("Updated application crashed, rolling back: %v", err)
+				if rollbackErr := rollbackUnhealthyUpdate(config, backup, newPID); rollbackErr != nil {
+					return fmt.Errorf("CRITICAL: %w", rollbackErr)
+				}
+				return withExitCode(ExitHealthFailed, errors.New("update rolled back: updated application did not stay running"))
+			}
+		}
+
+		if config.VerifyRunningBinary {
+			// Only count the update as done once the new code is what's actually running
+			if err := verifyRunningBinary(newPID, config.CurrentPath); err != nil {
+				return withExitCode(ExitHealthFailed, fmt.Errorf("update not confirmed: %w", err))
+			}
+		}
+
+		if config.HandoffSocket != "" {
+			// Step 4: Let the old instance hand its running state to the new one
+			timeout := time.Duration(config.HandoffTimeout) * time.Second
+			if err := performHandoff(config.HandoffSocket, config.PID, newPID, timeout); err != nil {
+				warnf("Handoff failed: %v", err)
+			}
+		}
+
+		// Step 5: Only drop the backup once the new version answers its health check
+		// The watchdog already covered it
+		if config.HealthCheckURL != "" && config.WatchdogTimeout == 0 && backup != nil {
+			if err := waitForHealthy(config.HealthCheckURL, healthCheckTimeout(config)); err != nil {
+				warnf("Health check failed, rolling back: %v", err)
+				if rollbackErr := rollbackUnhealthyUpdate(config, backup, newPID); rollbackErr != nil {
+					return fmt.Errorf("CRITICAL: %w", rollbackErr)
+				}
+				return withExitCode(ExitHealthFailed, errors.New("update rolled back: health check failed"))
+			}
+		}
+
+		if verifyAfterLaunch {
+			finalizeBackup(backup, config)
+		}
+	}
+
+	infof("Update process completed successfully")
+	return nil
+}
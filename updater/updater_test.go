@@ -0,0 +1,337 @@
+package updater
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// writeTestTree fills root with files spread over nested directories, each with
+// distinct content, and returns their contents by relative path and total size
+func writeTestTree(t testing.TB, root string, files, size int) (map[string][]byte, int64) {
+	t.Helper()
+	contents := make(map[string][]byte, files)
+	var total int64
+	for i := 0; i < files; i++ {
+		relPath := filepath.Join(fmt.Sprintf("dir%d", i%7), fmt.Sprintf("sub%d", i%3), fmt.Sprintf("file%d.dat", i))
+		prefix := []byte(fmt.Sprintf("%d:", i))
+		data := bytes.Repeat(prefix, (size+i%13)/len(prefix)+1)[:size+i%13]
+		path := filepath.Join(root, relPath)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		contents[relPath] = data
+		total += int64(len(data))
+	}
+	return contents, total
+}
+
+func TestCopyDirectoryTreeConcurrent(t *testing.T) {
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "dst")
+	contents, total := writeTestTree(t, src, 300, 4096)
+
+	var last Progress
+	reports := 0
+	opts := &copyOptions{
+		sourceRoot:  src,
+		concurrency: 8,
+		tracker: newProgressTracker(len(contents), total, func(p Progress) {
+			last = p
+			reports++
+		}),
+	}
+	if err := copyDirectoryTree(src, dst, opts); err != nil {
+		t.Fatalf("copyDirectoryTree: %v", err)
+	}
+
+	for relPath, want := range contents {
+		got, err := os.ReadFile(filepath.Join(dst, relPath))
+		if err != nil {
+			t.Fatalf("%s: %v", relPath, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: content differs from the source", relPath)
+		}
+	}
+
+	if reports == 0 {
+		t.Fatal("no progress was reported")
+	}
+	if last.Processed != len(contents) || last.ProcessedBytes != total {
+		t.Errorf("final progress %d files, %d bytes; want %d files, %d bytes", last.Processed, last.ProcessedBytes, len(contents), total)
+	}
+	if last.TotalFiles != len(contents) || last.TotalBytes != total {
+		t.Errorf("progress totals %d files, %d bytes; want %d files, %d bytes", last.TotalFiles, last.TotalBytes, len(contents), total)
+	}
+}
+
+func BenchmarkCopyDirectoryTree(b *testing.B) {
+	src := b.TempDir()
+	contents, total := writeTestTree(b, src, 2000, 2048)
+
+	for _, bench := range []struct {
+		name    string
+		workers int
+	}{
+		{"sequential", 1},
+		{fmt.Sprintf("workers=%d", runtime.NumCPU()), runtime.NumCPU()},
+	} {
+		workers := bench.workers
+		b.Run(bench.name, func(b *testing.B) {
+			b.SetBytes(total)
+			for i := 0; i < b.N; i++ {
+				dst := filepath.Join(b.TempDir(), "dst")
+				opts := &copyOptions{sourceRoot: src, concurrency: workers}
+				if err := copyDirectoryTree(src, dst, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(contents)), "files/op")
+		})
+	}
+}
+
+func TestCopyDirectoryTreeKeepsExecutableMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no executable permission bits")
+	}
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "dst")
+	binary := filepath.Join(src, "bin", "app")
+	if err := os.MkdirAll(filepath.Dir(binary), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(binary, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(binary, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copyDirectoryTree(src, dst, &copyOptions{sourceRoot: src, concurrency: 1}); err != nil {
+		t.Fatalf("copyDirectoryTree: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(dst, "bin", "app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0755 {
+		t.Errorf("copied binary has mode %#o, want 0755", mode)
+	}
+}
+
+func TestCheckDistinctPaths(t *testing.T) {
+	root := t.TempDir()
+	current := filepath.Join(root, "app")
+	sibling := filepath.Join(root, "app-new")
+	for _, dir := range []string{filepath.Join(current, "update"), sibling} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alias := filepath.Join(root, "app-link")
+	hasSymlink := os.Symlink(current, alias) == nil
+
+	tests := []struct {
+		name        string
+		current     string
+		new         string
+		wantErr     bool
+		needSymlink bool
+	}{
+		{"distinct siblings", current, sibling, false, false},
+		{"identical paths", current, current, true, false},
+		{"identical after cleaning", current, current + string(filepath.Separator) + ".", true, false},
+		{"new inside current", current, filepath.Join(current, "update"), true, false},
+		{"current inside new", filepath.Join(current, "update"), current, true, false},
+		{"new aliases current through a symlink", current, alias, true, true},
+		{"new inside current through a symlink", current, filepath.Join(alias, "update"), true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.needSymlink && !hasSymlink {
+				t.Skip("symlinks are not available")
+			}
+			err := checkDistinctPaths(tt.current, tt.new)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkDistinctPaths(%s, %s) = %v, want error: %t", tt.current, tt.new, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// writeExecutables creates an executable for each name in dir, with the .exe
+// extension on Windows, and returns dir's path to each by name
+func writeExecutables(t *testing.T, dir string, names ...string) map[string]string {
+	t.Helper()
+	paths := make(map[string]string, len(names))
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if runtime.GOOS == "windows" {
+			path += ".exe"
+		}
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		paths[name] = path
+	}
+	return paths
+}
+
+func TestAppNameCandidates(t *testing.T) {
+	tests := []struct {
+		appName string
+		want    []string
+	}{
+		{"", nil},
+		{"app", []string{"app"}},
+		{"app,app-cli", []string{"app", "app-cli"}},
+		{" app , ,App.exe ", []string{"app", "App.exe"}},
+	}
+	for _, tt := range tests {
+		got := appNameCandidates(tt.appName)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("appNameCandidates(%q) = %q, want %q", tt.appName, got, tt.want)
+		}
+	}
+}
+
+func TestFindExecutableInDirectory(t *testing.T) {
+	dir := t.TempDir()
+	// a-helper sorts first but looks like a helper, so alpha is the fallback
+	exes := writeExecutables(t, dir, "a-helper", "alpha", "beta", "gamma")
+	if err := os.WriteFile(filepath.Join(dir, "readme.txt"), []byte("docs"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		appName string
+		want    string
+	}{
+		{"first listed name wins", "gamma,beta", exes["gamma"]},
+		{"later name when the first is missing", "missing,beta", exes["beta"]},
+		{"name matches ignoring case and .exe", "BETA.exe", exes["beta"]},
+		{"no name falls back to the first candidate", "", exes["alpha"]},
+		{"unmatched names fall back to the first candidate", "missing", exes["alpha"]},
+		{"a helper is launched when asked for", "a-helper", exes["a-helper"]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findExecutableInDirectory(dir, appNameCandidates(tt.appName))
+			if err != nil {
+				t.Fatalf("findExecutableInDirectory: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("findExecutableInDirectory(%q) = %s, want %s", tt.appName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyKeepsEmptyDirectories(t *testing.T) {
+	emptyDirs := map[string]os.FileMode{
+		"plugins":         0750,
+		"tmp":             0777 | os.ModeSticky,
+		"share/cache/new": 0700,
+	}
+	src := t.TempDir()
+	writeExecutables(t, src, "app")
+	for relPath, mode := range emptyDirs {
+		dir := filepath.Join(src, filepath.FromSlash(relPath))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(dir, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	copies := map[string]func(src, dst string, opts *copyOptions) error{
+		"copyDirectoryTree":          copyDirectoryTree,
+		"copyAppBundleDirectoryTree": copyAppBundleDirectoryTree,
+	}
+	for name, copyTree := range copies {
+		t.Run(name, func(t *testing.T) {
+			dst := filepath.Join(t.TempDir(), "dst")
+			if err := copyTree(src, dst, &copyOptions{sourceRoot: src, concurrency: 1}); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			for relPath, mode := range emptyDirs {
+				info, err := os.Stat(filepath.Join(dst, filepath.FromSlash(relPath)))
+				if err != nil {
+					t.Errorf("empty directory %s was not recreated: %v", relPath, err)
+					continue
+				}
+				if !info.IsDir() {
+					t.Errorf("%s is not a directory", relPath)
+					continue
+				}
+				if runtime.GOOS == "windows" {
+					continue // Directory modes are not kept there
+				}
+				if got := info.Mode() & (os.ModePerm | os.ModeSticky); got != mode {
+					t.Errorf("%s has mode %v, want %v", relPath, got, mode)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyRunSettingsResetsEarlierRun(t *testing.T) {
+	applyRunSettings(&UpdateConfig{
+		VersionFile:       "VERSION.custom",
+		RetryAttempts:     9,
+		RetryBackoffMS:    900,
+		SubprocessTimeout: 5,
+		MaxCopyRate:       1 << 20,
+		CopyBufferSize:    4096,
+		TmpDir:            t.TempDir(),
+		Ignore:            []string{"*.log"},
+		Preserve:          []string{"config"},
+	})
+	applyRunSettings(&UpdateConfig{})
+
+	switch {
+	case appVersionFile != versionFileName:
+		t.Errorf("appVersionFile = %q, want %q", appVersionFile, versionFileName)
+	case fileRetryAttempts != defaultFileRetryAttempts || fileRetryBackoff != defaultFileRetryBackoff:
+		t.Errorf("retries = %d every %v, want %d every %v", fileRetryAttempts, fileRetryBackoff, defaultFileRetryAttempts, defaultFileRetryBackoff)
+	case subprocessTimeout != defaultSubprocessTimeout:
+		t.Errorf("subprocessTimeout = %v, want %v", subprocessTimeout, defaultSubprocessTimeout)
+	case copyRateLimiter != nil:
+		t.Error("copyRateLimiter is still set")
+	case copyBufferSize != defaultCopyBufferSize:
+		t.Errorf("copyBufferSize = %d, want %d", copyBufferSize, defaultCopyBufferSize)
+	case tempDir != "" || ignorePatterns != nil || preservePatterns != nil:
+		t.Errorf("tempDir %q, ignore %q and preserve %q carried over", tempDir, ignorePatterns, preservePatterns)
+	}
+}
+
+func TestUpdateRejectsInaccessiblePaths(t *testing.T) {
+	t.Cleanup(func() { applyRunSettings(&UpdateConfig{}) })
+	root := t.TempDir()
+	file := filepath.Join(root, "file")
+	if err := os.WriteFile(file, []byte("not a directory"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A path through a regular file fails to stat without being reported as missing
+	unreachable := filepath.Join(file, "app")
+	dir := t.TempDir()
+
+	for _, cfg := range []UpdateConfig{
+		{CurrentPath: unreachable, NewPath: dir, NoLaunch: true},
+		{CurrentPath: dir, NewPath: unreachable, NoLaunch: true},
+	} {
+		err := Update(cfg)
+		if code := ExitCode(err); code != ExitBadArgs {
+			t.Errorf("Update(%s, %s) = %v with exit code %d, want exit code %d", cfg.CurrentPath, cfg.NewPath, err, code, ExitBadArgs)
+		}
+	}
+}
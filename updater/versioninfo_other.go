@@ -0,0 +1,12 @@
+//go:build !windows
+
+package updater
+
+import (
+	"fmt"
+)
+
+// readVersionStrings reads Windows version resources, which only exist on Windows builds
+func readVersionStrings(exePath string) (product, company string, err error) {
+	return "", "", fmt.Errorf("version resources are only readable on Windows")
+}
@@ -0,0 +1,82 @@
+//go:build windows
+
+package updater
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+)
+
+var (
+	versionDLL                  = syscall.NewLazyDLL("version.dll")
+	procGetFileVersionInfoSizeW = versionDLL.NewProc("GetFileVersionInfoSizeW")
+	procGetFileVersionInfoW     = versionDLL.NewProc("GetFileVersionInfoW")
+	procVerQueryValueW          = versionDLL.NewProc("VerQueryValueW")
+)
+
+// readVersionStrings returns the ProductName and CompanyName version resources of an executable
+func readVersionStrings(exePath string) (product, company string, err error) {
+	pathPtr, err := syscall.UTF16PtrFromString(exePath)
+	if err != nil {
+		return "", "", err
+	}
+
+	size, _, callErr := procGetFileVersionInfoSizeW.Call(uintptr(unsafe.Pointer(pathPtr)), 0)
+	if size == 0 {
+		return "", "", fmt.Errorf("no version information: %v", callErr)
+	}
+
+	info := make([]byte, size)
+	if ok, _, callErr := procGetFileVersionInfoW.Call(uintptr(unsafe.Pointer(pathPtr)), 0, size, uintptr(unsafe.Pointer(&info[0]))); ok == 0 {
+		return "", "", fmt.Errorf("failed to read version information: %v", callErr)
+	}
+
+	// The first language/code page pair selects the string table
+	offset, length, err := queryVersionValue(info, `\VarFileInfo\Translation`)
+	if err != nil || length < 4 || offset+4 > len(info) {
+		return "", "", fmt.Errorf("no version translation table")
+	}
+	table := fmt.Sprintf(`\StringFileInfo\%04x%04x\`,
+		binary.LittleEndian.Uint16(info[offset:]), binary.LittleEndian.Uint16(info[offset+2:]))
+
+	return versionString(info, table+"ProductName"), versionString(info, table+"CompanyName"), nil
+}
+
+// queryVersionValue locates the value VerQueryValue finds for query, returning its
+// offset inside info (rather than a raw pointer) and the length it reports
+func queryVersionValue(info []byte, query string) (offset, length int, err error) {
+	queryPtr, err := syscall.UTF16PtrFromString(query)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var value uintptr
+	var valueLen uint32
+	base := uintptr(unsafe.Pointer(&info[0]))
+	ok, _, _ := procVerQueryValueW.Call(base, uintptr(unsafe.Pointer(queryPtr)),
+		uintptr(unsafe.Pointer(&value)), uintptr(unsafe.Pointer(&valueLen)))
+	if ok == 0 || value < base || value >= base+uintptr(len(info)) {
+		return 0, 0, fmt.Errorf("%s not found", query)
+	}
+
+	return int(value - base), int(valueLen), nil
+}
+
+// versionString returns the string resource at query, or "" when it is absent
+func versionString(info []byte, query string) string {
+	offset, length, err := queryVersionValue(info, query)
+	if err != nil {
+		return ""
+	}
+
+	// For string values the reported length counts UTF-16 characters
+	chars := make([]uint16, 0, length)
+	for i := 0; i < length && offset+2*i+1 < len(info); i++ {
+		chars = append(chars, binary.LittleEndian.Uint16(info[offset+2*i:]))
+	}
+	return strings.TrimRight(string(utf16.Decode(chars)), "\x00")
+}
@@ -0,0 +1,66 @@
+package updater
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// runWatchdog guards the relaunched app for timeout. It passes as soon as
+// --health-check-url answers 200 OK, or when pid is still running once the time
+// is up. Without a URL the process exiting fails it at once; with one, the URL is
+// probed until the time is up, since a launcher may hand over to another process.
+func runWatchdog(config *UpdateConfig, pid int, timeout time.Duration) error {
+	url := config.HealthCheckURL
+	exited, err := watchLaunchedProcess(config, pid)
+	if err != nil {
+		return err
+	}
+	watchPID := exited != nil
+	if !watchPID && url == "" {
+		warnf("Cannot watch process %d without --health-check-url, skipping the watchdog", pid)
+		return nil
+	}
+
+	var probe <-chan time.Time
+	client := &http.Client{Timeout: healthProbeTimeout}
+	if url != "" {
+		ticker := time.NewTicker(healthCheckInterval)
+		defer ticker.Stop()
+		probe = ticker.C
+	}
+
+	infof("Watchdog: giving process %d %v to stay up or become healthy", pid, timeout)
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	exitStatus := ""
+	lastErr := fmt.Errorf("no response yet")
+	for {
+		select {
+		case status := <-exited:
+			exited, exitStatus = nil, status
+			if url == "" {
+				return fmt.Errorf("process %d exited (%s)", pid, status)
+			}
+			infof("Watchdog: process %d exited (%s), still waiting for %s", pid, status, url)
+
+		case <-probe:
+			if lastErr = probeHealth(client, url); lastErr == nil {
+				infof("Watchdog: %s is healthy", url)
+				return nil
+			}
+			debugf("Watchdog: %s: %v", url, lastErr)
+
+		case <-deadline.C:
+			if watchPID && exitStatus == "" {
+				infof("Watchdog: process %d is still running after %v", pid, timeout)
+				return nil
+			}
+			if exitStatus != "" {
+				return fmt.Errorf("process %d exited (%s) and %s never became healthy within %v: %v", pid, exitStatus, url, timeout, lastErr)
+			}
+			return fmt.Errorf("no healthy response from %s within %v: %v", url, timeout, lastErr)
+		}
+	}
+}
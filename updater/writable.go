@@ -0,0 +1,47 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// checkWritable makes sure the directories an update writes to accept new files:
+// currentPath itself, or the directory holding a single-file app, the --backup-dir
+// and the --tmp-dir. It creates and removes a temporary file in each.
+func checkWritable(currentPath string, config *UpdateConfig) error {
+	dirs := []string{currentPath}
+	if info, err := os.Stat(currentPath); err == nil && !info.IsDir() {
+		dirs[0] = filepath.Dir(currentPath)
+	}
+	if config.BackupDir != "" {
+		dirs = append(dirs, config.BackupDir)
+	}
+	if config.TmpDir != "" {
+		dirs = append(dirs, config.TmpDir)
+	}
+
+	for _, dir := range dirs {
+		probe, err := os.CreateTemp(dir, ".atom-updater-write-test-")
+		if err != nil {
+			if os.IsPermission(err) {
+				return fmt.Errorf("%s is not writable by this user, so the update needs elevated privileges: %s", dir, elevationHint())
+			}
+			return fmt.Errorf("cannot write to %s: %v", dir, err)
+		}
+		probe.Close()
+		if err := os.Remove(probe.Name()); err != nil {
+			return fmt.Errorf("cannot remove files from %s: %v", dir, err)
+		}
+	}
+	return nil
+}
+
+// elevationHint tells the user how to give the updater the rights it is missing
+func elevationHint() string {
+	if runtime.GOOS == "windows" {
+		return "run the updater as Administrator, or install the app in a folder the user can write to, such as %LOCALAPPDATA%"
+	}
+	return "run the updater with sudo (or as the owner of the app), or install the app in a directory the user can write to, such as ~/Applications"
+}